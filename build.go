@@ -1,6 +0,0 @@
-//go:build tools
-// +build tools
-
-package sqlitezstd
-
-import _ "github.com/SaveTheRbtz/zstd-seekable-format-go/cmd/zstdseek"
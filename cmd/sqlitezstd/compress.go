@@ -0,0 +1,114 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paulstuart/sqlitezstd"
+)
+
+func (c *cli) compress(ctx context.Context, args []string) error {
+	flags := c.flags("compress", "[flags] database.sqlite",
+		"Compresses a SQLite database into the seekable format, in frames of whole pages.")
+	output := flags.String("o", "", "output `file`, or - for stdout (default: the input with .zst appended)")
+	force := flags.Bool("f", false, "overwrite the output file if it exists")
+	var opts sqlitezstd.CompressOptions
+	flags.IntVar(&opts.Level, "level", 0, "zstd compression `level`, from 1 to 22 (default 3)")
+	flags.IntVar(&opts.PagesPerFrame, "pages", sqlitezstd.DefaultPagesPerFrame, "database pages per frame")
+	flags.IntVar(&opts.Concurrency, "concurrency", 0, "frames compressed in parallel (default GOMAXPROCS)")
+	if err := parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	input := flags.Arg(0)
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint: errcheck
+
+	return c.create(cmp.Or(*output, input+".zst"), *force, func(out io.Writer) error {
+		return sqlitezstd.CompressDB(ctx, in, out, opts)
+	})
+}
+
+func (c *cli) decompress(ctx context.Context, args []string) error {
+	flags := c.flags("decompress", "[flags] database.sqlite.zst",
+		"Decompresses a compressed database back to a plain SQLite file.")
+	output := flags.String("o", "", "output `file`, or - for stdout (default: the input without .zst)")
+	force := flags.Bool("f", false, "overwrite the output file if it exists")
+	if err := parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	name := flags.Arg(0)
+	if *output == "" {
+		if !strings.HasSuffix(name, ".zst") || strings.Contains(name, "://") {
+			return fmt.Errorf("cannot name the output of %s; use -o", name)
+		}
+		*output = strings.TrimSuffix(name, ".zst")
+	}
+
+	file, err := sqlitezstd.Open(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint: errcheck
+
+	return c.create(*output, *force, func(out io.Writer) error {
+		_, err := io.Copy(out, io.NewSectionReader(readerAt{ctx, file}, 0, file.Size()))
+		return err
+	})
+}
+
+// create writes the file path with write, or stdout if path is -. The
+// file is written under a temporary name and renamed into place, so that
+// it never holds partial output.
+func (c *cli) create(path string, force bool, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(c.stdout)
+	}
+
+	if !force {
+		if _, err := os.Lstat(path); err == nil {
+			return fmt.Errorf("%s already exists; use -f to overwrite it", path)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint: errcheck
+
+	if err := write(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readerAt reads a File with ctx, so that reads stop when it is done.
+type readerAt struct {
+	ctx  context.Context
+	file *sqlitezstd.File
+}
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.file.ReadAtContext(r.ctx, p, off)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/paulstuart/sqlitezstd"
+)
+
+func (c *cli) info(ctx context.Context, args []string) error {
+	flags := c.flags("info", "database.sqlite.zst",
+		"Describes the pages and frames of a compressed database.")
+	if err := parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	name := flags.Arg(0)
+	file, err := sqlitezstd.Open(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint: errcheck
+
+	n, err := sqlitezstd.PageSize(file)
+	if err != nil {
+		return err
+	}
+	pageSize := int64(n)
+	frames := file.Frames()
+	aligned := true
+	sizes := make([]int64, len(frames))
+	compressedSizes := make([]int64, len(frames))
+	for i, frame := range frames {
+		sizes[i] = frame.Size
+		compressedSizes[i] = frame.CompressedSize
+		aligned = aligned && frame.Offset%pageSize == 0 && (frame.Size%pageSize == 0 || i == len(frames)-1)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "database:\t%s\n", name)
+	fmt.Fprintf(w, "size:\t%d bytes\n", file.Size())
+	fmt.Fprintf(w, "page size:\t%d bytes\n", pageSize)
+	fmt.Fprintf(w, "pages:\t%d\n", file.Size()/pageSize)
+	fmt.Fprintf(w, "compressed size:\t%d bytes\n", file.CompressedSize())
+	if file.CompressedSize() > 0 {
+		fmt.Fprintf(w, "compression ratio:\t%.2f\n", float64(file.Size())/float64(file.CompressedSize()))
+	}
+	fmt.Fprintf(w, "frames:\t%d\n", len(frames))
+	fmt.Fprintf(w, "frame size:\t%s\n", distribution(sizes))
+	fmt.Fprintf(w, "compressed frame size:\t%s\n", distribution(compressedSizes))
+	fmt.Fprintf(w, "page-aligned frames:\t%s\n", yesNo(aligned))
+	fmt.Fprintf(w, "checksums:\t%s\n", yesNo(file.Checksums()))
+	return w.Flush()
+}
+
+// distribution summarizes sizes by their minimum, percentiles and maximum.
+func distribution(sizes []int64) string {
+	if len(sizes) == 0 {
+		return "-"
+	}
+
+	sorted := slices.Clone(sizes)
+	slices.Sort(sorted)
+	percentile := func(p float64) int64 {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	var total int64
+	for _, size := range sorted {
+		total += size
+	}
+	return fmt.Sprintf("min %d, median %d, p90 %d, max %d, mean %d bytes",
+		sorted[0], percentile(0.5), percentile(0.9), sorted[len(sorted)-1], total/int64(len(sorted)))
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
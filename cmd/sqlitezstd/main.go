@@ -0,0 +1,136 @@
+// Command sqlitezstd compresses SQLite databases into the Zstandard
+// seekable format read by the sqlitezstd VFS, and inspects, verifies and
+// queries compressed databases, on the command line or over HTTP.
+//
+// Usage:
+//
+//	sqlitezstd compress [-level n] [-pages n] [-concurrency n] [-o output] [-f] database.sqlite
+//	sqlitezstd decompress [-o output] [-f] database.sqlite.zst
+//	sqlitezstd info database.sqlite.zst
+//	sqlitezstd verify database.sqlite.zst
+//	sqlitezstd query database.sqlite.zst 'SELECT ...'
+//	sqlitezstd serve [-addr address] [-max-rows n] [-timeout d] [-tables list] [-functions list] [name=]database.sqlite.zst ...
+//
+// Compressed databases may be named by any name the VFS opens, such as a
+// local path, an https:// URL or an s3:// object. The command uses the
+// SQLite driver selected at build time, like the sqlitezstd package: build
+// with -tags sqlitezstd_mattn or -tags sqlitezstd_modernc to use
+// mattn/go-sqlite3 or modernc.org/sqlite instead of ncruces/go-sqlite3.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+)
+
+const usage = `Usage: sqlitezstd <command> [flags] <database>
+
+Commands:
+  compress    compress a SQLite database into the seekable format
+  decompress  decompress a database back to a plain SQLite file
+  info        describe the pages and frames of a compressed database
+  verify      decode every frame and check the integrity of a database
+  query       run a SQL query against a compressed database
+  serve       serve read-only SQL queries against databases over HTTP
+
+Run 'sqlitezstd <command> -h' for the flags of a command.
+`
+
+// cli is an invocation of the command, writing results to stdout and
+// usage messages to stderr.
+type cli struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands = map[string]func(c *cli, ctx context.Context, args []string) error{
+	"compress":   (*cli).compress,
+	"decompress": (*cli).decompress,
+	"info":       (*cli).info,
+	"verify":     (*cli).verify,
+	"query":      (*cli).query,
+	"serve":      (*cli).serve,
+}
+
+// errUsage reports invalid arguments, whose explanation has already been
+// written to stderr.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command line args and returns the exit status: 0 on
+// success, 1 on failure and 2 on invalid usage.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		fmt.Fprint(stderr, usage)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "sqlitezstd: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	c := &cli{stdout: stdout, stderr: stderr}
+	err := cmd(c, ctx, args[1:])
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(stderr, "sqlitezstd %s: %v\n", args[0], err)
+		return 1
+	}
+}
+
+// flags returns the flag set of the command name, whose positional
+// arguments are described by args.
+func (c *cli) flags(name, args, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: sqlitezstd %s %s\n\n%s\n", name, args, description)
+		var hasFlags bool
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(c.stderr, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// atLeastOne is the number of positional arguments of a command taking
+// one or more.
+const atLeastOne = -1
+
+// parse parses the arguments of a command, which takes n positional
+// arguments.
+func parse(fs *flag.FlagSet, args []string, n int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if n == atLeastOne && fs.NArg() == 0 || n != atLeastOne && fs.NArg() != n {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paulstuart/sqlitezstd"
+)
+
+const rowCount = 5_000
+
+// createDatabase builds a small database and returns its path.
+func createDatabase(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.sqlite")
+	client, err := sql.Open(sqlitezstd.DriverName, "file:"+path)
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	_, err = client.Exec(`CREATE TABLE entries (id INTEGER PRIMARY KEY, name TEXT);`)
+	require.NoError(t, err)
+	tx, err := client.Begin()
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback() }()
+	for id := 1; id <= rowCount; id++ {
+		_, err = tx.Exec("INSERT INTO entries (id, name) VALUES (?, ?)", id, fmt.Sprintf("entry-%d", id))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+	require.NoError(t, client.Close())
+	return path
+}
+
+// runCommand runs the command line args and returns its exit status and
+// output.
+func runCommand(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := run(t.Context(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	path := createDatabase(t)
+	original, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	code, _, stderr := runCommand(t, "compress", "-level", "9", "-pages", "4", path)
+	require.Zero(t, code, stderr)
+	zstPath := path + ".zst"
+	require.FileExists(t, zstPath)
+
+	// Existing files are not overwritten by accident.
+	code, _, stderr = runCommand(t, "compress", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "already exists")
+
+	code, stdout, stderr := runCommand(t, "info", zstPath)
+	require.Zero(t, code, stderr)
+	assert.Regexp(t, `page size: +4096 bytes`, stdout)
+	assert.Regexp(t, fmt.Sprintf(`pages: +%d\n`, len(original)/4096), stdout)
+	assert.Regexp(t, `frame size: +min \d+, median 16384, p90 16384, max 16384`, stdout)
+	assert.Regexp(t, `page-aligned frames: +yes`, stdout)
+	assert.Regexp(t, `compression ratio: +\d+\.\d\d`, stdout)
+
+	code, stdout, stderr = runCommand(t, "verify", zstPath)
+	require.Zero(t, code, stderr)
+	assert.Contains(t, stdout, "checksums verified")
+	assert.Contains(t, stdout, "integrity check: ok")
+
+	code, stdout, stderr = runCommand(t, "query", zstPath, "SELECT id, name, NULL AS missing FROM entries WHERE id <= 2 ORDER BY id DESC")
+	require.Zero(t, code, stderr)
+	assert.Equal(t, "id\tname\tmissing\n2\tentry-2\tNULL\n1\tentry-1\tNULL\n", stdout)
+
+	decompressed := filepath.Join(t.TempDir(), "out.sqlite")
+	code, _, stderr = runCommand(t, "decompress", "-o", decompressed, zstPath)
+	require.Zero(t, code, stderr)
+	got, err := os.ReadFile(decompressed)
+	require.NoError(t, err)
+	assert.Equal(t, original, got)
+}
+
+func TestVerifyCorrupt(t *testing.T) {
+	path := createDatabase(t)
+	code, _, stderr := runCommand(t, "compress", path)
+	require.Zero(t, code, stderr)
+
+	zstPath := path + ".zst"
+	compressed, err := os.ReadFile(zstPath)
+	require.NoError(t, err)
+	compressed[len(compressed)/2] ^= 0xff
+	require.NoError(t, os.WriteFile(zstPath, compressed, 0o644))
+
+	code, _, stderr = runCommand(t, "verify", zstPath)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "sqlitezstd verify: frame")
+}
+
+func TestUsage(t *testing.T) {
+	code, _, stderr := runCommand(t)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "Usage: sqlitezstd <command>")
+
+	code, _, stderr = runCommand(t, "bogus")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown command "bogus"`)
+
+	code, _, stderr = runCommand(t, "query", "db.sqlite.zst")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "Usage: sqlitezstd query")
+
+	code, _, _ = runCommand(t, "info", "-h")
+	assert.Zero(t, code)
+
+	code, _, stderr = runCommand(t, "serve")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "Usage: sqlitezstd serve")
+
+	code, _, stderr = runCommand(t, "decompress", "https://example.com/db")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "use -o")
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestServe(t *testing.T) {
+	path := createDatabase(t)
+	code, _, stderr := runCommand(t, "compress", path)
+	require.Zero(t, code, stderr)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	var output lockedBuffer
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"serve", "-addr", "127.0.0.1:0", "-max-rows", "2", "-tables", "entries", path + ".zst"}, io.Discard, &output)
+	}()
+
+	address := regexp.MustCompile(`http://\S+`)
+	require.Eventually(t, func() bool { return address.MatchString(output.String()) }, 10*time.Second, 10*time.Millisecond, output.String())
+	url := address.FindString(output.String())
+
+	resp, err := http.Get(url + "/databases")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.JSONEq(t, `["test"]`, string(body))
+
+	resp, err = http.Post(url+"/databases/test/query", "application/json", strings.NewReader(`{"sql": "SELECT name FROM entries WHERE id > ? ORDER BY id", "params": [10]}`))
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.JSONEq(t, `{"columns": ["name"], "rows": [["entry-11"], ["entry-12"]], "truncated": true}`, string(body))
+
+	cancel()
+	select {
+	case code := <-done:
+		assert.Zero(t, code, output.String())
+	case <-time.After(10 * time.Second):
+		t.Fatal("serve did not stop")
+	}
+}
+
+func TestParseDatabases(t *testing.T) {
+	databases, err := parseDatabases([]string{
+		"data/test.sqlite.zst",
+		"other=data/test.sqlite.zst",
+		"https://example.com/files/remote.db.zst?token=a=b",
+		"s3://bucket/key.sqlite.zst",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"test":   "data/test.sqlite.zst",
+		"other":  "data/test.sqlite.zst",
+		"remote": "https://example.com/files/remote.db.zst?token=a=b",
+		"key":    "s3://bucket/key.sqlite.zst",
+	}, databases)
+
+	_, err = parseDatabases([]string{"a/test.sqlite.zst", "b/test.sqlite.zst"})
+	assert.ErrorContains(t, err, "two databases are named test")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+func (c *cli) query(ctx context.Context, args []string) error {
+	flags := c.flags("query", "[flags] database.sqlite.zst 'SELECT ...'",
+		"Runs a SQL query against a compressed database and prints the rows it\n"+
+			"returns, tab-separated.")
+	header := flags.Bool("header", true, "print the column names first")
+	if err := parse(flags, args, 2); err != nil {
+		return err
+	}
+
+	db, err := openDB(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint: errcheck
+
+	rows, err := db.QueryContext(ctx, flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if *header {
+		fmt.Fprintln(c.stdout, strings.Join(columns, "\t"))
+	}
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	fields := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		for i, value := range values {
+			switch v := value.(type) {
+			case nil:
+				fields[i] = "NULL"
+			case []byte:
+				fields[i] = string(v)
+			default:
+				fields[i] = fmt.Sprint(v)
+			}
+		}
+		fmt.Fprintln(c.stdout, strings.Join(fields, "\t"))
+	}
+	return rows.Err()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/paulstuart/sqlitezstd/server"
+)
+
+// databaseName matches the names databases may be given on the command
+// line, as name=database.
+var databaseName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func (c *cli) serve(ctx context.Context, args []string) error {
+	flags := c.flags("serve", "[flags] [name=]database.sqlite.zst ...",
+		"Serves read-only SQL queries against compressed databases over HTTP, as\n"+
+			"JSON. Each database is served under its name, by default its file name\n"+
+			"without extensions:\n\n"+
+			"  GET  /databases                   list the databases\n"+
+			"  GET  /databases/{database}/tables list the tables of a database\n"+
+			"  GET  /databases/{database}/stats  report the VFS statistics of a database\n"+
+			"  POST /databases/{database}/query  run {\"sql\": ..., \"params\": [...]}")
+	addr := flags.String("addr", "localhost:8080", "`address` to listen on")
+	var cfg server.Config
+	flags.IntVar(&cfg.MaxRows, "max-rows", server.DefaultMaxRows, "most rows a query returns")
+	flags.DurationVar(&cfg.Timeout, "timeout", server.DefaultTimeout, "time a query may run for")
+	flags.Func("tables", "comma-separated `list` of the tables queries may read (default all)", func(s string) error {
+		cfg.Tables = append(cfg.Tables, strings.Split(s, ",")...)
+		return nil
+	})
+	flags.Func("functions", "comma-separated `list` of the SQL functions queries may call (default none)", func(s string) error {
+		cfg.Functions = append(cfg.Functions, strings.Split(s, ",")...)
+		return nil
+	})
+	flags.BoolVar(&cfg.AllowAllFunctions, "allow-all-functions", false, "let queries call every SQL function but load_extension and the like, ignoring -functions")
+	if err := parse(flags, args, atLeastOne); err != nil {
+		return err
+	}
+
+	databases, err := parseDatabases(flags.Args())
+	if err != nil {
+		return err
+	}
+	cfg.Databases = databases
+
+	handler, err := server.NewHandler(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer handler.Close() //nolint: errcheck
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(c.stderr, "sqlitezstd serve: serving %d databases on http://%s\n", len(databases), listener.Addr())
+	if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// parseDatabases returns the databases named by args, each either
+// name=database or a database served under its file name without
+// extensions.
+func parseDatabases(args []string) (map[string]string, error) {
+	databases := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, database, ok := strings.Cut(arg, "=")
+		if !ok || !databaseName.MatchString(name) {
+			name, database = defaultName(arg), arg
+		}
+		if _, ok := databases[name]; ok {
+			return nil, fmt.Errorf("two databases are named %s; name them with name=database", name)
+		}
+		databases[name] = database
+	}
+	return databases, nil
+}
+
+// defaultName returns the name a database is served under by default: the
+// last element of its path, up to the first dot.
+func defaultName(database string) string {
+	base := filepath.Base(database)
+	if u, err := url.Parse(database); err == nil && strings.Contains(database, "://") {
+		base = path.Base(u.Path)
+	}
+	name, _, _ := strings.Cut(base, ".")
+	return name
+}
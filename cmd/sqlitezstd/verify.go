@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/paulstuart/sqlitezstd"
+)
+
+func (c *cli) verify(ctx context.Context, args []string) error {
+	flags := c.flags("verify", "database.sqlite.zst",
+		"Decodes every frame of a compressed database, verifying their checksums\n"+
+			"if it has them, and runs PRAGMA integrity_check on it through the VFS.")
+	if err := parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	name := flags.Arg(0)
+	file, err := sqlitezstd.Open(ctx, name, sqlitezstd.WithCacheSize(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint: errcheck
+
+	frames := file.Frames()
+	var largest int64
+	for _, frame := range frames {
+		largest = max(largest, frame.Size)
+	}
+	buf := make([]byte, largest)
+	for i, frame := range frames {
+		if _, err := file.ReadAtContext(ctx, buf[:frame.Size], frame.Offset); err != nil {
+			return fmt.Errorf("frame %d: %w", i, err)
+		}
+	}
+	checksums := "no checksums"
+	if file.Checksums() {
+		checksums = "checksums verified"
+	}
+	fmt.Fprintf(c.stdout, "frames: %d decoded, %s\n", len(frames), checksums)
+
+	db, err := openDB(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint: errcheck
+
+	rows, err := db.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	var problems []string
+	for rows.Next() {
+		var problem string
+		if err := rows.Scan(&problem); err != nil {
+			return err
+		}
+		problems = append(problems, problem)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		return fmt.Errorf("integrity check failed:\n%s", strings.Join(problems, "\n"))
+	}
+	fmt.Fprintln(c.stdout, "integrity check: ok")
+	return nil
+}
+
+// openDB opens the compressed database name through the VFS with the
+// driver the command was built with.
+func openDB(ctx context.Context, name string) (*sql.DB, error) {
+	db, err := sql.Open(sqlitezstd.DriverName, sqlitezstd.DSN(name)+"&mode=ro")
+	if err != nil {
+		return nil, err
+	}
+
+	// Temporary tables cannot be written next to a read-only database. The
+	// pragma applies to the single connection the command uses.
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, "PRAGMA temp_store = memory"); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,34 @@
+//go:build cgo
+
+package mattn
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/paulstuart/sqlitezstd/internal/core"
+)
+
+// SetAuthorizer installs auth as the authorizer of conn, a connection of
+// the mattn/go-sqlite3 driver such as the one (*sql.Conn).Raw passes to
+// its function. A nil auth removes the authorizer. mattn/go-sqlite3 does
+// not report the trigger or view responsible for an access, so auth is
+// always passed an empty trigger.
+//
+// mattn/go-sqlite3 keeps every authorizer installed on a connection until
+// the connection is closed, so it is best installed once per connection.
+func SetAuthorizer(conn any, auth core.Authorizer) error {
+	c, ok := conn.(*sqlite3.SQLiteConn)
+	if !ok {
+		return fmt.Errorf("not a mattn/go-sqlite3 connection: %T", conn)
+	}
+	if auth == nil {
+		c.RegisterAuthorizer(nil)
+		return nil
+	}
+	c.RegisterAuthorizer(func(action int, arg1, arg2, database string) int {
+		return int(auth(core.AuthorizerAction(action), arg1, arg2, database, ""))
+	})
+	return nil
+}
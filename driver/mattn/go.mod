@@ -1,28 +0,0 @@
-module github.com/paulstuart/sqlitezstd/driver/mattn
-
-go 1.25.4
-
-require (
-	github.com/SaveTheRbtz/zstd-seekable-format-go/pkg v0.8.0
-	github.com/klauspost/compress v1.18.2
-	github.com/mattn/go-sqlite3 v1.14.32
-	github.com/paulstuart/sqlitezstd v0.0.0-20251214214417-b9372bb199f4
-	github.com/psanford/httpreadat v0.1.0
-	github.com/psanford/sqlite3vfs v0.0.0-20251127171934-4e34e03a991a
-)
-
-require (
-	github.com/SaveTheRbtz/fastcdc-go v0.3.0 // indirect
-	github.com/SaveTheRbtz/zstd-seekable-format-go/cmd/zstdseek v0.8.0 // indirect
-	github.com/cespare/xxhash/v2 v2.3.0 // indirect
-	github.com/google/btree v1.1.3 // indirect
-	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
-	github.com/rivo/uniseg v0.4.7 // indirect
-	github.com/schollz/progressbar/v3 v3.18.0 // indirect
-	go.uber.org/atomic v1.11.0 // indirect
-	go.uber.org/multierr v1.11.0 // indirect
-	go.uber.org/zap v1.27.0 // indirect
-	golang.org/x/sync v0.17.0 // indirect
-	golang.org/x/sys v0.38.0 // indirect
-	golang.org/x/term v0.36.0 // indirect
-)
@@ -0,0 +1,71 @@
+//go:build cgo
+
+package mattn
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestQueryContextStopsRemoteReads checks that cancelling a query
+// interrupts the connection through the xOpen wrapper in uri.c, so the
+// stalled range request of a remote database is abandoned.
+func TestQueryContextStopsRemoteReads(t *testing.T) {
+	zstPath := createDatabase(t)
+	compressed, err := os.ReadFile(zstPath)
+	require.NoError(t, err)
+
+	// Serve the seek table and the first frame, but stall reads of the
+	// other frames. The seek table ends with its frame count and a
+	// descriptor whose top bit flags 4 byte checksums.
+	footer := compressed[len(compressed)-9:]
+	entrySize := 8
+	if footer[4]&0x80 != 0 {
+		entrySize = 12
+	}
+	seekTable := len(compressed) - (8 + int(binary.LittleEndian.Uint32(footer))*entrySize + len(footer))
+
+	var stalled atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test.sqlite.zst" {
+			http.NotFound(w, r)
+			return
+		}
+		var start int
+		_, _ = fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start)
+		if start > 0 && start < seekTable {
+			stalled.Add(1)
+			defer stalled.Add(-1)
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "test.sqlite.zst", time.Time{}, bytes.NewReader(compressed))
+	}))
+	defer server.Close()
+
+	client, err := sql.Open("sqlite3", fmt.Sprintf("file:%s/test.sqlite.zst?vfs=zstd&zstd_cache=0", server.URL))
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	var count int64
+	err = client.QueryRowContext(ctx, "SELECT COUNT(name) FROM entries;").Scan(&count)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Eventually(t, func() bool { return stalled.Load() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
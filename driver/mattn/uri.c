@@ -0,0 +1,69 @@
+// The Go VFS interface only receives the database name, but the URI
+// parameters of a main database follow its name in the string SQLite
+// passes to xOpen. zstdOpen wraps the registered xOpen to hand those
+// parameters to Go before the Go VFS opens the file.
+//
+// The Go VFS is not told which connection reads a file either, so main
+// database files get I/O methods whose xFileControl passes the connection
+// from SQLITE_FCNTL_PDB to Go, which polls it for interrupts.
+
+#include "uri.h"
+
+static int (*zstdNextOpen)(sqlite3_vfs*, const char*, sqlite3_file*, int, int*);
+static int (*zstdNextClose)(sqlite3_file*);
+static int (*zstdNextFileControl)(sqlite3_file*, int, void*);
+
+// zstdIO is a copy of the Go VFS's I/O methods with xClose and
+// xFileControl replaced. It is set up by zstdInitIO on the first open.
+static sqlite3_io_methods zstdIO;
+
+static int zstdOpen(sqlite3_vfs *vfs, const char *zName, sqlite3_file *file, int flags, int *outFlags) {
+  int i, rc;
+  const char *key;
+
+  if (zName == 0 || (flags & SQLITE_OPEN_MAIN_DB) == 0) {
+    return zstdNextOpen(vfs, zName, file, flags, outFlags);
+  }
+
+  zstdBeginOpen((char*)zName);
+  for (i = 0; (key = sqlite3_uri_key(zName, i)) != 0; i++) {
+    zstdURIParameter((char*)zName, (char*)key, (char*)sqlite3_uri_parameter(zName, key));
+  }
+  rc = zstdNextOpen(vfs, zName, file, flags, outFlags);
+  if (rc == SQLITE_OK && zstdOpened(file, (char*)zName)) {
+    file->pMethods = &zstdIO;
+  }
+  zstdEndOpen((char*)zName);
+  return rc;
+}
+
+static int zstdClose(sqlite3_file *file) {
+  zstdClosed(file);
+  return zstdNextClose(file);
+}
+
+static int zstdFileControl(sqlite3_file *file, int op, void *pArg) {
+  if (op == SQLITE_FCNTL_PDB) {
+    zstdSetDB(file, *(sqlite3**)pArg);
+    return SQLITE_OK;
+  }
+  return zstdNextFileControl(file, op, pArg);
+}
+
+void zstdInitIO(sqlite3_file *file) {
+  zstdIO = *file->pMethods;
+  zstdNextClose = zstdIO.xClose;
+  zstdNextFileControl = zstdIO.xFileControl;
+  zstdIO.xClose = zstdClose;
+  zstdIO.xFileControl = zstdFileControl;
+}
+
+int zstdWrapOpen(const char *vfsName) {
+  sqlite3_vfs *vfs = sqlite3_vfs_find(vfsName);
+  if (vfs == 0) {
+    return SQLITE_ERROR;
+  }
+  zstdNextOpen = vfs->xOpen;
+  vfs->xOpen = zstdOpen;
+  return SQLITE_OK;
+}
@@ -0,0 +1,81 @@
+package mattn
+
+/*
+#cgo darwin LDFLAGS: -Wl,-undefined,dynamic_lookup
+
+#include <stdlib.h>
+#include "uri.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/paulstuart/sqlitezstd/internal/core"
+)
+
+var (
+	// uriParams carries URI parameters from the xOpen wrapper in uri.c to
+	// ZstdVFS.Open, and the opened ZstdFile back.
+	uriParams core.URIParameterStash
+
+	// files maps the sqlite3_file of each main database opened through
+	// the wrapper to its ZstdFile.
+	files sync.Map
+
+	initIO sync.Once
+)
+
+// wrapOpen installs the xOpen wrapper on the registered VFS name.
+func wrapOpen(name string) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	if rc := C.zstdWrapOpen(cname); rc != C.SQLITE_OK {
+		return fmt.Errorf("vfs %q not found", name)
+	}
+	return nil
+}
+
+//export zstdBeginOpen
+func zstdBeginOpen(name *C.char) {
+	uriParams.Begin(C.GoString(name))
+}
+
+//export zstdURIParameter
+func zstdURIParameter(name, key, value *C.char) {
+	uriParams.Add(C.GoString(name), C.GoString(key), C.GoString(value))
+}
+
+//export zstdOpened
+func zstdOpened(file *C.sqlite3_file, name *C.char) C.int {
+	zf, ok := uriParams.Value(C.GoString(name)).(*ZstdFile)
+	if !ok {
+		return 0
+	}
+
+	initIO.Do(func() { C.zstdInitIO(file) })
+	files.Store(file, zf)
+	return 1
+}
+
+//export zstdSetDB
+func zstdSetDB(file *C.sqlite3_file, db *C.sqlite3) {
+	if zf, ok := files.Load(file); ok {
+		zf.(*ZstdFile).file.SetInterrupt(func() bool {
+			return C.sqlite3_is_interrupted(db) != 0
+		})
+	}
+}
+
+//export zstdClosed
+func zstdClosed(file *C.sqlite3_file) {
+	files.Delete(file)
+}
+
+//export zstdEndOpen
+func zstdEndOpen(name *C.char) {
+	uriParams.End(C.GoString(name))
+}
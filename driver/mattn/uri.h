@@ -0,0 +1,71 @@
+#ifndef ZSTD_URI_H
+#define ZSTD_URI_H
+
+// The SQLite declarations used by uri.c. The implementation is linked in
+// from mattn/go-sqlite3.
+
+#define SQLITE_OK 0
+#define SQLITE_ERROR 1
+#define SQLITE_OPEN_MAIN_DB 0x00000100
+#define SQLITE_FCNTL_PDB 30
+
+typedef long long sqlite3_int64;
+typedef struct sqlite3 sqlite3;
+typedef struct sqlite3_file sqlite3_file;
+typedef struct sqlite3_io_methods sqlite3_io_methods;
+typedef struct sqlite3_vfs sqlite3_vfs;
+
+struct sqlite3_file {
+  const sqlite3_io_methods *pMethods;
+};
+
+struct sqlite3_io_methods {
+  int iVersion;
+  int (*xClose)(sqlite3_file*);
+  int (*xRead)(sqlite3_file*, void*, int iAmt, sqlite3_int64 iOfst);
+  int (*xWrite)(sqlite3_file*, const void*, int iAmt, sqlite3_int64 iOfst);
+  int (*xTruncate)(sqlite3_file*, sqlite3_int64 size);
+  int (*xSync)(sqlite3_file*, int flags);
+  int (*xFileSize)(sqlite3_file*, sqlite3_int64 *pSize);
+  int (*xLock)(sqlite3_file*, int);
+  int (*xUnlock)(sqlite3_file*, int);
+  int (*xCheckReservedLock)(sqlite3_file*, int *pResOut);
+  int (*xFileControl)(sqlite3_file*, int op, void *pArg);
+  int (*xSectorSize)(sqlite3_file*);
+  int (*xDeviceCharacteristics)(sqlite3_file*);
+  int (*xShmMap)(sqlite3_file*, int iPg, int pgsz, int, void volatile**);
+  int (*xShmLock)(sqlite3_file*, int offset, int n, int flags);
+  void (*xShmBarrier)(sqlite3_file*);
+  int (*xShmUnmap)(sqlite3_file*, int deleteFlag);
+  int (*xFetch)(sqlite3_file*, sqlite3_int64 iOfst, int iAmt, void **pp);
+  int (*xUnfetch)(sqlite3_file*, sqlite3_int64 iOfst, void *p);
+};
+
+// The leading members of struct sqlite3_vfs, up to the one uri.c replaces.
+struct sqlite3_vfs {
+  int iVersion;
+  int szOsFile;
+  int mxPathname;
+  sqlite3_vfs *pNext;
+  const char *zName;
+  void *pAppData;
+  int (*xOpen)(sqlite3_vfs*, const char *zName, sqlite3_file*, int flags, int *pOutFlags);
+};
+
+sqlite3_vfs *sqlite3_vfs_find(const char *zVfsName);
+const char *sqlite3_uri_key(const char *zFilename, int N);
+const char *sqlite3_uri_parameter(const char *zFilename, const char *zParam);
+int sqlite3_is_interrupted(sqlite3 *db);
+
+int zstdWrapOpen(const char *vfsName);
+void zstdInitIO(sqlite3_file *file);
+
+// Implemented in Go, see uri.go.
+extern void zstdBeginOpen(char *name);
+extern void zstdURIParameter(char *name, char *key, char *value);
+extern int zstdOpened(sqlite3_file *file, char *name);
+extern void zstdEndOpen(char *name);
+extern void zstdSetDB(sqlite3_file *file, sqlite3 *db);
+extern void zstdClosed(sqlite3_file *file);
+
+#endif
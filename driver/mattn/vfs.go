@@ -1,3 +1,5 @@
+//go:build cgo
+
 // Package mattn provides a Zstandard VFS adapter for mattn/go-sqlite3.
 // This adapter enables read-only access to Zstandard-compressed SQLite databases
 // using the CGO-based mattn/go-sqlite3 driver.
@@ -9,23 +11,24 @@
 //	import _ "github.com/paulstuart/sqlitezstd/driver/mattn"
 //
 //	db, err := sql.Open("sqlite3", "database.sqlite.zst?vfs=zstd")
+//
+// The zstd_* URI parameters are only passed on by mattn/go-sqlite3 for
+// names with the file: prefix, e.g.
+// "file:database.sqlite.zst?vfs=zstd&zstd_cache=64MiB".
 package mattn
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/url"
-	"os"
 	"strings"
 	"sync"
 
-	seekable "github.com/SaveTheRbtz/zstd-seekable-format-go/pkg"
-	"github.com/klauspost/compress/zstd"
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/psanford/httpreadat"
 	"github.com/psanford/sqlite3vfs"
 
-	"github.com/paulstuart/sqlitezstd"
+	"github.com/paulstuart/sqlitezstd/internal/core"
 )
 
 // ZstdVFS implements the VFS interface for Zstandard compressed databases.
@@ -53,56 +56,24 @@ func (z *ZstdVFS) FullPathname(name string) string {
 
 // Open opens a compressed database file for reading.
 func (z *ZstdVFS) Open(name string, flags sqlite3vfs.OpenFlag) (sqlite3vfs.File, sqlite3vfs.OpenFlag, error) {
-	var (
-		err    error
-		reader io.ReadSeeker
-	)
-
-	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
-		uri, err := url.Parse(name)
-		if err != nil {
-			return nil, 0, sqlite3vfs.CantOpenError
-		}
-
-		httpRanger := httpreadat.New(uri.String())
-		size, err := httpRanger.Size()
-		if err != nil {
-			return nil, 0, sqlite3vfs.CantOpenError
-		}
-
-		reader = &sqlitezstd.ReadSeeker{
-			ReaderAt: httpRanger,
-			Size:     size,
-		}
-	} else {
-		reader, err = os.Open(name)
-		if err != nil {
-			return nil, 0, sqlite3vfs.CantOpenError
-		}
-	}
-
-	decoder, err := zstd.NewReader(nil)
-	if err != nil {
-		return nil, 0, sqlite3vfs.CantOpenError
+	var params url.Values
+	if flags&sqlite3vfs.OpenMainDB != 0 {
+		params = uriParams.Get(name)
 	}
 
-	seekable, err := seekable.NewReader(reader, decoder)
+	file, err := core.OpenURI(context.Background(), name, params)
 	if err != nil {
-		return nil, 0, sqlite3vfs.CantOpenError
+		return nil, 0, sqliteError(core.OpenErrorCode(err))
 	}
 
-	return &ZstdFile{
-		decoder:  decoder,
-		reader:   reader,
-		seekable: seekable,
-	}, flags | sqlite3vfs.OpenReadOnly, nil
+	zf := &ZstdFile{file: file}
+	uriParams.Set(name, zf)
+	return zf, flags | sqlite3vfs.OpenReadOnly, nil
 }
 
 // ZstdFile represents an open Zstandard compressed database file for mattn driver.
 type ZstdFile struct {
-	decoder  *zstd.Decoder
-	reader   io.ReadSeeker
-	seekable seekable.Reader
+	file *core.File
 }
 
 var _ sqlite3vfs.File = &ZstdFile{}
@@ -112,11 +83,7 @@ func (z *ZstdFile) CheckReservedLock() (bool, error) {
 }
 
 func (z *ZstdFile) Close() error {
-	_ = z.seekable.Close()
-	if closer, ok := z.reader.(io.Closer); ok {
-		_ = closer.Close()
-	}
-	return nil
+	return z.file.Close()
 }
 
 func (z *ZstdFile) DeviceCharacteristics() sqlite3vfs.DeviceCharacteristic {
@@ -124,7 +91,7 @@ func (z *ZstdFile) DeviceCharacteristics() sqlite3vfs.DeviceCharacteristic {
 }
 
 func (z *ZstdFile) FileSize() (int64, error) {
-	return z.seekable.Seek(0, io.SeekEnd)
+	return z.file.Size(), nil
 }
 
 func (z *ZstdFile) Lock(elock sqlite3vfs.LockType) error {
@@ -132,7 +99,11 @@ func (z *ZstdFile) Lock(elock sqlite3vfs.LockType) error {
 }
 
 func (z *ZstdFile) ReadAt(p []byte, off int64) (int, error) {
-	return z.seekable.ReadAt(p, off)
+	n, err := z.file.ReadAt(p, off)
+	if err != nil && err != io.EOF {
+		return n, sqliteError(core.ReadErrorCode(err))
+	}
+	return n, err
 }
 
 func (z *ZstdFile) SectorSize() int64 {
@@ -155,12 +126,32 @@ func (z *ZstdFile) WriteAt(p []byte, off int64) (int, error) {
 	return 0, sqlite3vfs.ReadOnlyError
 }
 
+// sqliteError returns the sqlite3vfs error for code. sqlite3vfs only
+// recognizes its own error values, so the cause of the error is not
+// passed on to SQLite.
+func sqliteError(code core.Code) error {
+	switch code {
+	case core.CodeIOErrRead:
+		return sqlite3vfs.IOErrorRead
+	case core.CodeIOErrShortRead:
+		return sqlite3vfs.IOErrorShortRead
+	case core.CodeCorrupt:
+		return sqlite3vfs.CorruptError
+	case core.CodeAuth:
+		return sqlite3vfs.AuthError
+	case core.CodeInterrupt:
+		return sqlite3vfs.InterruptError
+	default:
+		return sqlite3vfs.CantOpenError
+	}
+}
+
 var once = sync.OnceValue(func() error {
 	err := sqlite3vfs.RegisterVFS("zstd", &ZstdVFS{})
 	if err != nil {
 		return fmt.Errorf("could not register vfs: %w", err)
 	}
-	return nil
+	return wrapOpen("zstd")
 })
 
 func init() {
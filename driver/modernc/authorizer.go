@@ -0,0 +1,121 @@
+package modernc
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/paulstuart/sqlitezstd/internal/core"
+)
+
+// modernc.org/sqlite has no authorizer API, so SetAuthorizer takes the
+// sqlite3 handle from the driver's connection and installs authorize with
+// sqlite3_set_authorizer, the way uriOpen is installed on the VFS. Each
+// installation gets its own id, passed as the user data of the callback
+// and kept as the connection's client data, whose destructor forgets the
+// Authorizer when the connection closes or the authorizer is replaced.
+
+// xAuth is the sqlite3_set_authorizer callback as translated by
+// modernc.org/sqlite.
+type xAuth = func(tls *libc.TLS, pUserData uintptr, action int32, zArg1, zArg2, zDatabase, zTrigger uintptr) int32
+
+// xDestructor is the sqlite3_set_clientdata destructor as translated by
+// modernc.org/sqlite.
+type xDestructor = func(tls *libc.TLS, pData uintptr)
+
+var (
+	// authorizers maps the id of each installed authorizer to its
+	// Authorizer.
+	authorizers sync.Map
+
+	// authorizerID is the last id given to an authorizer; ids are never
+	// zero, which sqlite3_set_clientdata takes as a deletion.
+	authorizerID atomic.Uintptr
+
+	// clientDataName is the name of the client data holding the id, in
+	// memory SQLite can read.
+	clientDataName = sync.OnceValue(func() uintptr {
+		name, err := libc.CString("sqlitezstd.authorizer")
+		if err != nil {
+			panic(err)
+		}
+		return name
+	})
+
+	authorize xAuth = func(tls *libc.TLS, pUserData uintptr, action int32, zArg1, zArg2, zDatabase, zTrigger uintptr) int32 {
+		v, ok := authorizers.Load(pUserData)
+		if !ok {
+			return sqlite3.SQLITE_DENY
+		}
+		return int32(v.(core.Authorizer)(core.AuthorizerAction(action),
+			libc.GoString(zArg1), libc.GoString(zArg2), libc.GoString(zDatabase), libc.GoString(zTrigger)))
+	}
+
+	forget xDestructor = func(tls *libc.TLS, pData uintptr) {
+		authorizers.Delete(pData)
+	}
+)
+
+// SetAuthorizer installs auth as the authorizer of conn, a connection of
+// the modernc.org/sqlite driver such as the one (*sql.Conn).Raw passes to
+// its function. A nil auth removes the authorizer.
+func SetAuthorizer(conn any, auth core.Authorizer) error {
+	db, err := handle(conn)
+	if err != nil {
+		return err
+	}
+
+	tls := libc.NewTLS()
+	defer tls.Close()
+
+	if auth == nil {
+		if err := resultError("sqlite3_set_authorizer", sqlite3.Xsqlite3_set_authorizer(tls, db, 0, 0)); err != nil {
+			return err
+		}
+		return resultError("sqlite3_set_clientdata", sqlite3.Xsqlite3_set_clientdata(tls, db, clientDataName(), 0, 0))
+	}
+
+	id := authorizerID.Add(1)
+	authorizers.Store(id, auth)
+	// On failure SQLite calls forget itself.
+	rc := sqlite3.Xsqlite3_set_clientdata(tls, db, clientDataName(), id, *(*uintptr)(unsafe.Pointer(&forget)))
+	if err := resultError("sqlite3_set_clientdata", rc); err != nil {
+		return err
+	}
+	return resultError("sqlite3_set_authorizer", sqlite3.Xsqlite3_set_authorizer(tls, db, *(*uintptr)(unsafe.Pointer(&authorize)), id))
+}
+
+// handle returns the sqlite3 handle of conn, the db field of the
+// driver's unexported connection type. modernc.org/sqlite exposes the
+// handle neither on the connection nor to its connection hooks, so this
+// relies on the layout of the version go.mod requires, which TestHandle
+// checks.
+func handle(conn any) (uintptr, error) {
+	v := reflect.ValueOf(conn)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct || v.Type().Elem().PkgPath() != "modernc.org/sqlite" {
+		return 0, fmt.Errorf("not a modernc.org/sqlite connection: %T", conn)
+	}
+	field, ok := v.Type().Elem().FieldByName("db")
+	if !ok || field.Type.Kind() != reflect.Uintptr {
+		return 0, fmt.Errorf("unsupported modernc.org/sqlite connection: %T has no uintptr db field", conn)
+	}
+	db := *(*uintptr)(unsafe.Add(v.UnsafePointer(), field.Offset))
+	if db == 0 {
+		return 0, fmt.Errorf("modernc.org/sqlite connection is closed")
+	}
+	return db, nil
+}
+
+// resultError returns an error for the SQLite result code rc of the
+// function fn, or nil for SQLITE_OK.
+func resultError(fn string, rc int32) error {
+	if rc == sqlite3.SQLITE_OK {
+		return nil
+	}
+	return fmt.Errorf("%s failed with result code %d", fn, rc)
+}
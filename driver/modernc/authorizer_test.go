@@ -0,0 +1,108 @@
+package modernc
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/paulstuart/sqlitezstd/internal/core"
+)
+
+// installed returns the number of authorizers SetAuthorizer holds.
+func installed() int {
+	n := 0
+	authorizers.Range(func(any, any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// TestHandle fails if modernc.org/sqlite no longer keeps the sqlite3
+// handle in the db field of its connection, which SetAuthorizer needs.
+func TestHandle(t *testing.T) {
+	client, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	conn, err := client.Conn(t.Context())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	require.NoError(t, conn.Raw(func(dc any) error {
+		db, err := handle(dc)
+		if err != nil {
+			return fmt.Errorf("modernc.org/sqlite changed its connection type; SetAuthorizer needs updating: %w", err)
+		}
+		// The handle is the connection's: SQLite reports its main database.
+		tls := libc.NewTLS()
+		defer tls.Close()
+		if name := libc.GoString(sqlite3.Xsqlite3_db_name(tls, db, 0)); name != "main" {
+			return fmt.Errorf("db field is not a sqlite3 handle: database 0 is %q", name)
+		}
+		return nil
+	}))
+
+	_, err = handle(client)
+	assert.ErrorContains(t, err, "not a modernc.org/sqlite connection")
+}
+
+func TestSetAuthorizer(t *testing.T) {
+	zstPath := createDatabase(t)
+	dsn := "file:" + zstPath + "?vfs=" + VFSName()
+	client, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	deny := func(action core.AuthorizerAction, _, _, _, _ string) core.AuthorizerResult {
+		if action == core.ActionRead {
+			return core.AuthorizerDeny
+		}
+		return core.AuthorizerOK
+	}
+	allow := func(core.AuthorizerAction, string, string, string, string) core.AuthorizerResult {
+		return core.AuthorizerOK
+	}
+	countEntries := func(conn *sql.Conn) error {
+		var n int64
+		return conn.QueryRowContext(t.Context(), "SELECT COUNT(name) FROM entries;").Scan(&n)
+	}
+	before := installed()
+
+	conn, err := client.Conn(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, conn.Raw(func(dc any) error { return SetAuthorizer(dc, deny) }))
+	assert.ErrorContains(t, countEntries(conn), "prohibited")
+	assert.Equal(t, before+1, installed())
+
+	// Replacing the authorizer forgets the one it replaces.
+	require.NoError(t, conn.Raw(func(dc any) error { return SetAuthorizer(dc, allow) }))
+	assert.NoError(t, countEntries(conn))
+	assert.Equal(t, before+1, installed())
+
+	require.NoError(t, conn.Raw(func(dc any) error { return SetAuthorizer(dc, nil) }))
+	assert.NoError(t, countEntries(conn))
+	assert.Equal(t, before, installed())
+
+	// Closing a connection forgets its authorizer, and a new connection,
+	// which may reuse the handle's address, has none.
+	require.NoError(t, conn.Raw(func(dc any) error { return SetAuthorizer(dc, deny) }))
+	assert.Equal(t, before+1, installed())
+	require.NoError(t, conn.Close())
+	require.NoError(t, client.Close())
+	assert.Equal(t, before, installed())
+
+	client, err = sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	conn, err = client.Conn(t.Context())
+	require.NoError(t, err)
+	defer conn.Close() //nolint: errcheck
+	assert.NoError(t, countEntries(conn))
+
+	assert.ErrorContains(t, SetAuthorizer(struct{}{}, deny), "not a modernc.org/sqlite connection")
+}
@@ -0,0 +1,181 @@
+package modernc
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/paulstuart/sqlitezstd/internal/core"
+)
+
+// The fs.FS interface only receives the database name, but the URI
+// parameters of a main database follow its name in the string SQLite
+// passes to xOpen. uriOpen wraps the registered xOpen to hand those
+// parameters to ZstdFS.Open before the VFS opens the file.
+//
+// modernc.org/sqlite/vfs also reports every open failure as CANTOPEN and
+// every read failure as IOERR_READ, so uriOpen maps open errors itself and
+// gives main database files I/O methods whose xRead does the same. Their
+// xFileControl takes the connection from SQLITE_FCNTL_PDB, which is then
+// polled for interrupts during reads.
+
+type (
+	// xOpen is sqlite3_vfs.xOpen as translated by modernc.org/sqlite.
+	xOpen = func(tls *libc.TLS, pVfs, zName, pFile uintptr, flags int32, pOutFlags uintptr) int32
+
+	// xRead is sqlite3_io_methods.xRead as translated by modernc.org/sqlite.
+	xRead = func(tls *libc.TLS, pFile, zBuf uintptr, iAmt int32, iOfst int64) int32
+
+	// xClose is sqlite3_io_methods.xClose as translated by modernc.org/sqlite.
+	xClose = func(tls *libc.TLS, pFile uintptr) int32
+
+	// xFileControl is sqlite3_io_methods.xFileControl as translated by
+	// modernc.org/sqlite.
+	xFileControl = func(tls *libc.TLS, pFile uintptr, op int32, pArg uintptr) int32
+)
+
+var (
+	// uriParams carries URI parameters from uriOpen to ZstdFS.Open, and
+	// the outcome of ZstdFS.Open back.
+	uriParams core.URIParameterStash
+
+	nextOpen        xOpen
+	nextClose       xClose
+	nextFileControl xFileControl
+
+	// zstdIO is a copy of the VFS's I/O methods with xRead, xClose and
+	// xFileControl replaced. It is set up by the first successful open.
+	zstdIO     sqlite3.Tsqlite3_io_methods
+	zstdIOOnce sync.Once
+
+	// files maps the sqlite3_file of each main database opened through
+	// uriOpen to its ZstdFile.
+	files sync.Map
+
+	// pollers maps the sqlite3_file of each main database to the TLS used
+	// to poll its connection for interrupts.
+	pollers sync.Map
+
+	uriOpen xOpen = func(tls *libc.TLS, pVfs, zName, pFile uintptr, flags int32, pOutFlags uintptr) int32 {
+		if zName == 0 || flags&sqlite3.SQLITE_OPEN_MAIN_DB == 0 {
+			return nextOpen(tls, pVfs, zName, pFile, flags, pOutFlags)
+		}
+
+		name := libc.GoString(zName)
+		uriParams.Begin(name)
+		defer uriParams.End(name)
+
+		for i := int32(0); ; i++ {
+			key := sqlite3.Xsqlite3_uri_key(tls, zName, i)
+			if key == 0 {
+				break
+			}
+			value := sqlite3.Xsqlite3_uri_parameter(tls, zName, key)
+			uriParams.Add(name, libc.GoString(key), libc.GoString(value))
+		}
+
+		rc := nextOpen(tls, pVfs, zName, pFile, flags, pOutFlags)
+
+		switch v := uriParams.Value(name).(type) {
+		case error:
+			return resultCode(core.OpenErrorCode(v))
+		case *ZstdFile:
+			if rc == sqlite3.SQLITE_OK {
+				file := *(**sqlite3.Tsqlite3_file)(unsafe.Pointer(&pFile))
+				zstdIOOnce.Do(func() {
+					zstdIO = **(**sqlite3.Tsqlite3_io_methods)(unsafe.Pointer(&file.FpMethods))
+					nextClose = *(*xClose)(unsafe.Pointer(&zstdIO.FxClose))
+					nextFileControl = *(*xFileControl)(unsafe.Pointer(&zstdIO.FxFileControl))
+					zstdIO.FxRead = *(*uintptr)(unsafe.Pointer(&uriRead))
+					zstdIO.FxClose = *(*uintptr)(unsafe.Pointer(&uriClose))
+					zstdIO.FxFileControl = *(*uintptr)(unsafe.Pointer(&uriFileControl))
+				})
+				files.Store(pFile, v)
+				file.FpMethods = uintptr(unsafe.Pointer(&zstdIO))
+			}
+		}
+
+		return rc
+	}
+
+	uriRead xRead = func(tls *libc.TLS, pFile, zBuf uintptr, iAmt int32, iOfst int64) int32 {
+		v, _ := files.Load(pFile)
+		buf := unsafe.Slice(*(**byte)(unsafe.Pointer(&zBuf)), iAmt)
+
+		n, err := v.(*ZstdFile).file.ReadAt(buf, iOfst)
+		if n == len(buf) {
+			return sqlite3.SQLITE_OK
+		}
+		clear(buf[n:])
+		return resultCode(core.ReadErrorCode(err))
+	}
+
+	uriClose xClose = func(tls *libc.TLS, pFile uintptr) int32 {
+		files.Delete(pFile)
+		if poll, ok := pollers.LoadAndDelete(pFile); ok {
+			poll.(*libc.TLS).Close()
+		}
+		return nextClose(tls, pFile)
+	}
+
+	uriFileControl xFileControl = func(tls *libc.TLS, pFile uintptr, op int32, pArg uintptr) int32 {
+		if op != sqlite3.SQLITE_FCNTL_PDB {
+			return nextFileControl(tls, pFile, op, pArg)
+		}
+
+		v, _ := files.Load(pFile)
+		db := **(**uintptr)(unsafe.Pointer(&pArg))
+		poll := libc.NewTLS()
+		if old, ok := pollers.Swap(pFile, poll); ok {
+			old.(*libc.TLS).Close()
+		}
+		v.(*ZstdFile).file.SetInterrupt(func() bool {
+			return sqlite3.Xsqlite3_is_interrupted(poll, db) != 0
+		})
+		return sqlite3.SQLITE_OK
+	}
+)
+
+// resultCode returns the SQLite result code for code.
+func resultCode(code core.Code) int32 {
+	switch code {
+	case core.CodeIOErrRead:
+		return sqlite3.SQLITE_IOERR_READ
+	case core.CodeIOErrShortRead:
+		return sqlite3.SQLITE_IOERR_SHORT_READ
+	case core.CodeCorrupt:
+		return sqlite3.SQLITE_CORRUPT
+	case core.CodeAuth:
+		return sqlite3.SQLITE_AUTH
+	case core.CodeInterrupt:
+		return sqlite3.SQLITE_INTERRUPT
+	default:
+		return sqlite3.SQLITE_CANTOPEN
+	}
+}
+
+// wrapOpen installs uriOpen on the registered VFS name.
+func wrapOpen(name string) error {
+	tls := libc.NewTLS()
+	defer tls.Close()
+
+	cname, err := libc.CString(name)
+	if err != nil {
+		return err
+	}
+	defer libc.Xfree(tls, cname)
+
+	p := sqlite3.Xsqlite3_vfs_find(tls, cname)
+	if p == 0 {
+		return fmt.Errorf("vfs %q not found", name)
+	}
+
+	// Function pointers in modernc.org/sqlite are Go func values.
+	vfs := *(**sqlite3.Tsqlite3_vfs)(unsafe.Pointer(&p))
+	nextOpen = *(*xOpen)(unsafe.Pointer(&vfs.FxOpen))
+	vfs.FxOpen = *(*uintptr)(unsafe.Pointer(&uriOpen))
+	return nil
+}
@@ -10,113 +10,62 @@
 package modernc
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/fs"
-	"net/url"
-	"os"
-	"strings"
 	"sync"
 	"time"
 
-	seekable "github.com/SaveTheRbtz/zstd-seekable-format-go/pkg"
-	"github.com/klauspost/compress/zstd"
-	"github.com/psanford/httpreadat"
 	_ "modernc.org/sqlite"
 	"modernc.org/sqlite/vfs"
 
-	"github.com/paulstuart/sqlitezstd"
+	"github.com/paulstuart/sqlitezstd/internal/core"
 )
 
 // ZstdFS implements a read-only fs.FS backed by Zstandard compressed files.
 // This adapter allows modernc.org/sqlite to read compressed databases.
-type ZstdFS struct {
-	openFiles map[string]*ZstdFile
-	mu        sync.Mutex
-}
+type ZstdFS struct{}
 
 // Open opens a compressed file for reading.
 func (z *ZstdFS) Open(name string) (fs.File, error) {
-	var (
-		err    error
-		reader io.ReadSeeker
-	)
-
-	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
-		uri, err := url.Parse(name)
-		if err != nil {
-			return nil, fmt.Errorf("invalid URL: %w", err)
-		}
-
-		httpRanger := httpreadat.New(uri.String())
-		size, err := httpRanger.Size()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get size: %w", err)
-		}
-
-		reader = &sqlitezstd.ReadSeeker{
-			ReaderAt: httpRanger,
-			Size:     size,
-		}
-	} else {
-		reader, err = os.Open(name)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	decoder, err := zstd.NewReader(nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create decoder: %w", err)
-	}
-
-	seekable, err := seekable.NewReader(reader, decoder)
+	file, err := z.open(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create seekable reader: %w", err)
+		uriParams.Set(name, err)
+		return nil, err
 	}
 
-	file := &ZstdFile{
-		name:     name,
-		decoder:  decoder,
-		reader:   reader,
-		seekable: seekable,
-	}
+	uriParams.Set(name, file)
+	return file, nil
+}
 
-	z.mu.Lock()
-	if z.openFiles == nil {
-		z.openFiles = make(map[string]*ZstdFile)
+func (z *ZstdFS) open(name string) (*ZstdFile, error) {
+	zf, err := core.OpenURI(context.Background(), name, uriParams.Get(name))
+	if err != nil {
+		return nil, err
 	}
-	z.openFiles[name] = file
-	z.mu.Unlock()
 
-	return file, nil
+	return &ZstdFile{
+		name: name,
+		file: zf,
+	}, nil
 }
 
 // ZstdFile represents an open Zstandard compressed database file for modernc driver.
 type ZstdFile struct {
-	name     string
-	decoder  *zstd.Decoder
-	reader   io.ReadSeeker
-	seekable seekable.Reader
-	offset   int64
+	name   string
+	file   *core.File
+	offset int64
 }
 
 // Stat returns file information.
 func (z *ZstdFile) Stat() (fs.FileInfo, error) {
-	size, err := z.seekable.Seek(0, io.SeekEnd)
-	if err != nil {
-		return nil, err
-	}
-	_, err = z.seekable.Seek(z.offset, io.SeekStart)
-	if err != nil {
-		return nil, err
-	}
-	return &fileInfo{name: z.name, size: size}, nil
+	return &fileInfo{name: z.name, size: z.file.Size()}, nil
 }
 
 // Read reads data from the compressed file.
 func (z *ZstdFile) Read(p []byte) (int, error) {
-	n, err := z.seekable.ReadAt(p, z.offset)
+	n, err := z.file.ReadAt(p, z.offset)
 	z.offset += int64(n)
 	return n, err
 }
@@ -131,11 +80,7 @@ func (z *ZstdFile) Seek(offset int64, whence int) (int64, error) {
 	case io.SeekCurrent:
 		newOffset = z.offset + offset
 	case io.SeekEnd:
-		size, err := z.seekable.Seek(0, io.SeekEnd)
-		if err != nil {
-			return 0, err
-		}
-		newOffset = size + offset
+		newOffset = z.file.Size() + offset
 	}
 	z.offset = newOffset
 	return newOffset, nil
@@ -143,11 +88,7 @@ func (z *ZstdFile) Seek(offset int64, whence int) (int64, error) {
 
 // Close closes the file.
 func (z *ZstdFile) Close() error {
-	_ = z.seekable.Close()
-	if closer, ok := z.reader.(io.Closer); ok {
-		_ = closer.Close()
-	}
-	return nil
+	return z.file.Close()
 }
 
 // fileInfo implements fs.FileInfo.
@@ -173,7 +114,7 @@ var (
 			return fmt.Errorf("could not register vfs: %w", err)
 		}
 		vfsName = name
-		return nil
+		return wrapOpen(name)
 	})
 )
 
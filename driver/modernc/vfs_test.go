@@ -0,0 +1,104 @@
+package modernc
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paulstuart/sqlitezstd/internal/core"
+)
+
+const rowCount = 5_000
+
+// createDatabase builds a small database with modernc.org/sqlite and
+// compresses it, returning the .zst path.
+func createDatabase(t *testing.T) string {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "test.sqlite")
+	client, err := sql.Open("sqlite", "file:"+dbPath)
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	_, err = client.Exec(`CREATE TABLE entries (id INTEGER PRIMARY KEY, name TEXT);`)
+	require.NoError(t, err)
+	tx, err := client.Begin()
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback() }()
+	for id := 1; id <= rowCount; id++ {
+		_, err = tx.Exec("INSERT INTO entries (id, name) VALUES (?, ?)", id, fmt.Sprintf("entry-%d", id))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+	require.NoError(t, client.Close())
+
+	in, err := os.Open(dbPath)
+	require.NoError(t, err)
+	defer in.Close() //nolint: errcheck
+	out, err := os.Create(dbPath + ".zst")
+	require.NoError(t, err)
+	defer out.Close() //nolint: errcheck
+	require.NoError(t, core.CompressDB(t.Context(), in, out, core.CompressOptions{}))
+	require.NoError(t, out.Close())
+	return dbPath + ".zst"
+}
+
+// count opens the database name with the zstd VFS and URI parameters
+// params, and counts its entries.
+func count(t *testing.T, name, params string) (int64, error) {
+	t.Helper()
+
+	client, err := sql.Open("sqlite", fmt.Sprintf("file:%s?vfs=%s&%s", name, VFSName(), params))
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	var n int64
+	err = client.QueryRow("SELECT COUNT(*) FROM entries;").Scan(&n)
+	return n, err
+}
+
+func TestURIParameters(t *testing.T) {
+	zstPath := createDatabase(t)
+
+	for _, tc := range []struct {
+		params string
+		want   string
+	}{
+		{"zstd_cache=64MiB&zstd_readahead=4&zstd_timeout=5s&zstd_verify=1", ""},
+		{"zstd_cache=0&zstd_verify=0", ""},
+		{"cache=shared&zstd_readahead=2", ""},
+		{"zstd_bogus=1", "unable to open database file"},
+		{"zstd_cache=lots", "unable to open database file"},
+	} {
+		t.Run(tc.params, func(t *testing.T) {
+			n, err := count(t, zstPath, tc.params)
+			if tc.want != "" {
+				assert.ErrorContains(t, err, tc.want)
+				return
+			}
+			require.NoError(t, err)
+			assert.EqualValues(t, rowCount, n)
+		})
+	}
+}
+
+func TestReadErrorCodes(t *testing.T) {
+	zstPath := createDatabase(t)
+	compressed, err := os.ReadFile(zstPath)
+	require.NoError(t, err)
+	for i := len(compressed) / 2; i < len(compressed)/2+64; i++ {
+		compressed[i] ^= 0x55
+	}
+	corruptPath := filepath.Join(t.TempDir(), "corrupt.sqlite.zst")
+	require.NoError(t, os.WriteFile(corruptPath, compressed, 0o600))
+
+	// The xRead installed by uriOpen reports corrupt frames as
+	// SQLITE_CORRUPT rather than SQLITE_IOERR_READ.
+	_, err = count(t, corruptPath, "zstd_cache=0")
+	assert.ErrorContains(t, err, "malformed")
+}
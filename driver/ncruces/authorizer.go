@@ -0,0 +1,25 @@
+package ncruces
+
+import (
+	"fmt"
+
+	"github.com/ncruces/go-sqlite3"
+
+	"github.com/paulstuart/sqlitezstd/internal/core"
+)
+
+// SetAuthorizer installs auth as the authorizer of conn, a connection of
+// the ncruces/go-sqlite3 driver such as the one (*sql.Conn).Raw passes to
+// its function. A nil auth removes the authorizer.
+func SetAuthorizer(conn any, auth core.Authorizer) error {
+	c, ok := conn.(interface{ Raw() *sqlite3.Conn })
+	if !ok {
+		return fmt.Errorf("not a ncruces/go-sqlite3 connection: %T", conn)
+	}
+	if auth == nil {
+		return c.Raw().SetAuthorizer(nil)
+	}
+	return c.Raw().SetAuthorizer(func(action sqlite3.AuthorizerActionCode, name3rd, name4th, schema, inner string) sqlite3.AuthorizerReturnCode {
+		return sqlite3.AuthorizerReturnCode(auth(core.AuthorizerAction(action), name3rd, name4th, schema, inner))
+	})
+}
@@ -8,13 +8,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
 
 	"github.com/brianvoe/gofakeit/v7"
+
+	"github.com/paulstuart/sqlitezstd/internal/core"
 )
 
 // nolint: gosec
@@ -123,40 +124,9 @@ func setupDB(b *testing.B) (string, string) {
 
 	slog.Info("commit.end")
 
-	// Assuming the compression step is the same as in the test,
-	// and that it's already correctly set up and works.
 	zstPath = dbPath + ".zst"
 
-	cmd := exec.Command(
-		"go", "run", "github.com/SaveTheRbtz/zstd-seekable-format-go/cmd/zstdseek",
-		"-f", dbPath,
-		"-o", zstPath,
-		"-c", "16:32:64",
-	)
-
-	cmd.Stdout = os.Stderr
-	cmd.Stderr = os.Stderr
-
-	err = cmd.Start()
-	if err != nil {
-		b.Fatalf("Failed to start compression: %v", err)
-	}
-
-	// Wait with timeout
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Wait()
-	}()
-
-	select {
-	case err := <-done:
-		if err != nil {
-			b.Fatalf("Failed to compress database: %v", err)
-		}
-	case <-time.After(30 * time.Second):
-		_ = cmd.Process.Kill()
-		b.Fatal("zstdseek command timed out after 30 seconds")
-	}
+	compressDatabase(b, dbPath, zstPath, core.CompressOptions{PagesPerFrame: 8})
 
 	slog.Info("compression.end")
 
@@ -300,25 +270,63 @@ func BenchmarkReadCompressedHTTPSQLite(b *testing.B) {
 	server := httptest.NewServer(http.FileServer(http.Dir(zstDir)))
 	defer server.Close()
 
-	client, err := sql.Open("sqlite3", fmt.Sprintf("file:%s/%s?vfs=zstd", server.URL, filepath.Base(zstPath)))
-	if err != nil {
-		b.Fatalf("Query failed: %v", err)
-	}
-	defer client.Close() //nolint: errcheck
+	b.Run("lookup", func(b *testing.B) {
+		client, err := sql.Open("sqlite3", fmt.Sprintf("file:%s/%s?vfs=zstd", server.URL, filepath.Base(zstPath)))
+		if err != nil {
+			b.Fatalf("Query failed: %v", err)
+		}
+		defer client.Close() //nolint: errcheck
 
-	client.SetMaxOpenConns(max(4, runtime.NumCPU()))
+		client.SetMaxOpenConns(max(4, runtime.NumCPU()))
 
-	b.ResetTimer() // Start timing now.
+		b.ResetTimer() // Start timing now.
 
-	b.RunParallel(func(pb *testing.PB) {
-		var count int
-		for pb.Next() {
-			err = client.QueryRow("SELECT MAX(value) FROM entries").Scan(&count)
-			if err != nil {
-				b.Fatalf("Query failed: %v", err)
+		b.RunParallel(func(pb *testing.PB) {
+			var count int
+			for pb.Next() {
+				err = client.QueryRow("SELECT MAX(value) FROM entries").Scan(&count)
+				if err != nil {
+					b.Fatalf("Query failed: %v", err)
+				}
 			}
-		}
+		})
 	})
+
+	// Scans read the index frame by frame, so the round trip of each
+	// request dominates unless frames are read ahead.
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		http.FileServer(http.Dir(zstDir)).ServeHTTP(w, r)
+	}))
+	defer slowServer.Close()
+
+	for _, bc := range []struct {
+		name   string
+		params string
+	}{
+		{"scan", ""},
+		{"scan readahead", "&zstd_readahead=8"},
+		{"scan adaptive readahead", "&zstd_readahead_max=64"},
+		{"scan adaptive readahead parallel", "&zstd_readahead_max=64&zstd_readahead_concurrency=4"},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			// The cache is smaller than the index, so that every scan reads
+			// it from the server again.
+			client, err := sql.Open("sqlite3", fmt.Sprintf("file:%s/%s?vfs=zstd&zstd_cache=4MiB%s", slowServer.URL, filepath.Base(zstPath), bc.params))
+			if err != nil {
+				b.Fatalf("Failed to open database: %v", err)
+			}
+			defer client.Close() //nolint: errcheck
+
+			var count int
+			for b.Loop() {
+				err = client.QueryRow("SELECT COUNT(*) FROM entries").Scan(&count)
+				if err != nil {
+					b.Fatalf("Query failed: %v", err)
+				}
+			}
+		})
+	}
 }
 
 func BenchmarkReadCompressedRtreeSQLite(b *testing.B) {
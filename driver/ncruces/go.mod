@@ -1,35 +0,0 @@
-module github.com/paulstuart/sqlitezstd/driver/ncruces
-
-go 1.25.4
-
-require (
-	github.com/SaveTheRbtz/zstd-seekable-format-go/pkg v0.8.0
-	github.com/brianvoe/gofakeit/v7 v7.12.1
-	github.com/georgysavva/scany/v2 v2.1.4
-	github.com/klauspost/compress v1.18.2
-	github.com/ncruces/go-sqlite3 v0.30.3
-	github.com/paulstuart/sqlitezstd v0.0.0-20251214214417-b9372bb199f4
-	github.com/psanford/httpreadat v0.1.0
-	github.com/stretchr/testify v1.11.1
-)
-
-require (
-	github.com/SaveTheRbtz/fastcdc-go v0.3.0 // indirect
-	github.com/SaveTheRbtz/zstd-seekable-format-go/cmd/zstdseek v0.8.0 // indirect
-	github.com/cespare/xxhash/v2 v2.3.0 // indirect
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/google/btree v1.1.3 // indirect
-	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
-	github.com/ncruces/julianday v1.0.0 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/rivo/uniseg v0.4.7 // indirect
-	github.com/schollz/progressbar/v3 v3.18.0 // indirect
-	github.com/tetratelabs/wazero v1.10.1 // indirect
-	go.uber.org/atomic v1.11.0 // indirect
-	go.uber.org/multierr v1.11.0 // indirect
-	go.uber.org/zap v1.27.0 // indirect
-	golang.org/x/sync v0.18.0 // indirect
-	golang.org/x/sys v0.38.0 // indirect
-	golang.org/x/term v0.36.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
-)
@@ -8,15 +8,18 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/georgysavva/scany/v2/sqlscan"
+	"github.com/ncruces/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/paulstuart/sqlitezstd/internal/core"
 )
 
 const maxSize = 1_000_000
@@ -33,6 +36,22 @@ func (tw *trackingResponseWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// compressDatabase compresses the database at dbPath into zstPath.
+func compressDatabase(tb testing.TB, dbPath, zstPath string, opts core.CompressOptions) {
+	tb.Helper()
+
+	in, err := os.Open(dbPath)
+	require.NoError(tb, err)
+	defer in.Close() //nolint: errcheck
+
+	out, err := os.Create(zstPath)
+	require.NoError(tb, err)
+	defer out.Close() //nolint: errcheck
+
+	require.NoError(tb, core.CompressDB(tb.Context(), in, out, opts))
+	require.NoError(tb, out.Close())
+}
+
 func createDatabase(t *testing.T) string {
 	t.Helper()
 
@@ -68,37 +87,7 @@ func createDatabase(t *testing.T) string {
 	require.NoError(t, err)
 
 	zstPath := dbPath + ".zst"
-
-	cmd := exec.Command(
-		"go", "run", "github.com/SaveTheRbtz/zstd-seekable-format-go/cmd/zstdseek",
-		"-f", dbPath,
-		"-o", zstPath,
-	)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err = cmd.Start()
-	require.NoError(t, err)
-
-	// Wait with timeout
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Wait()
-	}()
-
-	select {
-	case err := <-done:
-		if err != nil {
-			t.Logf("Command failed with stdout:\n%s", stdout.String())
-			t.Logf("Command failed with stderr:\n%s", stderr.String())
-		}
-		require.NoError(t, err)
-	case <-time.After(30 * time.Second):
-		_ = cmd.Process.Kill()
-		t.Fatal("zstdseek command timed out after 30 seconds")
-	}
+	compressDatabase(t, dbPath, zstPath, core.CompressOptions{})
 
 	return zstPath
 }
@@ -158,39 +147,7 @@ func createComplexDatabase(t *testing.T) (string, string) {
 	require.NoError(t, err)
 
 	zstPath := dbPath + ".zst"
-
-	cmd := exec.Command(
-		"go", "run", "github.com/SaveTheRbtz/zstd-seekable-format-go/cmd/zstdseek",
-		"-f", dbPath,
-		"-o", zstPath,
-		"-t",
-		"-c", "16:32:64",
-	)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err = cmd.Start()
-	require.NoError(t, err)
-
-	// Wait with timeout
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Wait()
-	}()
-
-	select {
-	case err := <-done:
-		if err != nil {
-			t.Logf("Command failed with stdout:\n%s", stdout.String())
-			t.Logf("Command failed with stderr:\n%s", stderr.String())
-		}
-		require.NoError(t, err)
-	case <-time.After(30 * time.Second):
-		_ = cmd.Process.Kill()
-		t.Fatal("zstdseek command timed out after 30 seconds")
-	}
+	compressDatabase(t, dbPath, zstPath, core.CompressOptions{PagesPerFrame: 8})
 
 	return dbPath, zstPath
 }
@@ -258,6 +215,57 @@ func TestFileDoesNotExist(t *testing.T) {
 	assert.Error(t, row.Err())
 }
 
+func TestQueryContextStopsRemoteReads(t *testing.T) {
+	zstPath := createDatabase(t)
+	compressed, err := os.ReadFile(zstPath)
+	require.NoError(t, err)
+
+	// Serve the size probe, the seek table and the first frame, then stall.
+	var requests, stalled atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 4 {
+			stalled.Add(1)
+			defer stalled.Add(-1)
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "test.sqlite.zst", time.Time{}, bytes.NewReader(compressed))
+	}))
+	defer server.Close()
+
+	client, err := sql.Open("sqlite3", fmt.Sprintf("file:%s/test.sqlite.zst?vfs=zstd&zstd_cache=0", server.URL))
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	var sum int64
+	err = client.QueryRowContext(ctx, "SELECT SUM(id) FROM entries;").Scan(&sum)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Eventually(t, func() bool { return stalled.Load() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestOpenErrorCarriesItsCause(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, err := sql.Open("sqlite3", fmt.Sprintf("file:%s/missing.sqlite.zst?vfs=zstd", server.URL))
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	err = client.QueryRow("SELECT COUNT(*) FROM entries;").Err()
+	assert.ErrorIs(t, err, sqlite3.CANTOPEN)
+
+	var status *core.ErrRemoteStatus
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, http.StatusNotFound, status.Code)
+}
+
 func TestReadingFromHTTPServer(t *testing.T) {
 	zstPath := createDatabase(t)
 	zstDir := filepath.Dir(zstPath)
@@ -410,3 +418,39 @@ func TestHTTPRangeHeadersOnlyDownloadNeededBytes(t *testing.T) {
 	assert.Less(t, percentDownloaded, 50.0,
 		"Should download less than 50%% of file for single-row query, but downloaded %.2f%%", percentDownloaded)
 }
+
+func TestHTTPSourceReplacedWhileOpen(t *testing.T) {
+	zstPath := createDatabase(t)
+	fileInfo, err := os.Stat(zstPath)
+	require.NoError(t, err)
+
+	// Republishing the file changes its ETag.
+	var etag atomic.Value
+	etag.Store(`"v1"`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, err := os.Open(zstPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer file.Close() //nolint: errcheck
+
+		w.Header().Set("ETag", etag.Load().(string))
+		http.ServeContent(w, r, filepath.Base(zstPath), fileInfo.ModTime(), file)
+	}))
+	defer server.Close()
+
+	client, err := sql.Open("sqlite3", fmt.Sprintf("file:%s/%s?vfs=zstd&zstd_cache=0", server.URL, filepath.Base(zstPath)))
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+	client.SetMaxOpenConns(1)
+
+	var id int64
+	require.NoError(t, client.QueryRow("SELECT id FROM entries WHERE id = 1;").Scan(&id))
+
+	etag.Store(`"v2"`)
+	var count int64
+	err = client.QueryRow("SELECT COUNT(*) FROM entries;").Scan(&count)
+	assert.ErrorIs(t, err, sqlite3.IOERR)
+	assert.ErrorIs(t, err, core.ErrSourceChanged)
+}
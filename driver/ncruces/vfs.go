@@ -10,29 +10,26 @@
 package ncruces
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/url"
-	"os"
 	"strings"
 	"sync"
 
-	seekable "github.com/SaveTheRbtz/zstd-seekable-format-go/pkg"
-	"github.com/klauspost/compress/zstd"
 	"github.com/ncruces/go-sqlite3"
 	"github.com/ncruces/go-sqlite3/vfs"
-	"github.com/psanford/httpreadat"
 
 	_ "github.com/ncruces/go-sqlite3/driver"
 	_ "github.com/ncruces/go-sqlite3/embed"
 
-	"github.com/paulstuart/sqlitezstd"
+	"github.com/paulstuart/sqlitezstd/internal/core"
 )
 
 // ZstdVFS implements the VFS interface for Zstandard compressed databases.
 type ZstdVFS struct{}
 
-var _ vfs.VFS = &ZstdVFS{}
+var _ vfs.VFSFilename = &ZstdVFS{}
 
 // Access checks whether a file exists and can be accessed with the specified permissions.
 func (z *ZstdVFS) Access(name string, flags vfs.AccessFlag) (bool, error) {
@@ -54,56 +51,28 @@ func (z *ZstdVFS) FullPathname(name string) (string, error) {
 
 // Open opens a compressed database file for reading.
 func (z *ZstdVFS) Open(name string, flags vfs.OpenFlag) (vfs.File, vfs.OpenFlag, error) {
-	var (
-		err    error
-		reader io.ReadSeeker
-	)
-
-	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
-		uri, err := url.Parse(name)
-		if err != nil {
-			return nil, 0, sqlite3.CANTOPEN
-		}
-
-		httpRanger := httpreadat.New(uri.String())
-		size, err := httpRanger.Size()
-		if err != nil {
-			return nil, 0, sqlite3.CANTOPEN
-		}
-
-		reader = &sqlitezstd.ReadSeeker{
-			ReaderAt: httpRanger,
-			Size:     size,
-		}
-	} else {
-		reader, err = os.Open(name)
-		if err != nil {
-			return nil, 0, sqlite3.CANTOPEN
-		}
-	}
+	return z.open(name, nil, flags)
+}
 
-	decoder, err := zstd.NewReader(nil)
-	if err != nil {
-		return nil, 0, sqlite3.CANTOPEN
-	}
+// OpenFilename opens a compressed database file for reading, configured by
+// the zstd_* parameters of its URI.
+func (z *ZstdVFS) OpenFilename(name *vfs.Filename, flags vfs.OpenFlag) (vfs.File, vfs.OpenFlag, error) {
+	return z.open(name.String(), name.URIParameters(), flags)
+}
 
-	seekable, err := seekable.NewReader(reader, decoder)
+func (z *ZstdVFS) open(name string, params url.Values, flags vfs.OpenFlag) (vfs.File, vfs.OpenFlag, error) {
+	file, err := core.OpenURI(context.Background(), name, params)
 	if err != nil {
-		return nil, 0, sqlite3.CANTOPEN
+		return nil, 0, systemError(err, core.OpenErrorCode(err))
 	}
 
-	return &ZstdFile{
-		decoder:  decoder,
-		reader:   reader,
-		seekable: seekable,
-	}, flags | vfs.OPEN_READONLY, nil
+	return &ZstdFile{file: file}, flags | vfs.OPEN_READONLY, nil
 }
 
 // ZstdFile represents an open Zstandard compressed database file for ncruces driver.
 type ZstdFile struct {
-	decoder  *zstd.Decoder
-	reader   io.ReadSeeker
-	seekable seekable.Reader
+	file *core.File
+	conn *sqlite3.Conn
 }
 
 var _ vfs.File = &ZstdFile{}
@@ -113,11 +82,7 @@ func (z *ZstdFile) CheckReservedLock() (bool, error) {
 }
 
 func (z *ZstdFile) Close() error {
-	_ = z.seekable.Close()
-	if closer, ok := z.reader.(io.Closer); ok {
-		_ = closer.Close()
-	}
-	return nil
+	return z.file.Close()
 }
 
 func (z *ZstdFile) DeviceCharacteristics() vfs.DeviceCharacteristic {
@@ -125,15 +90,33 @@ func (z *ZstdFile) DeviceCharacteristics() vfs.DeviceCharacteristic {
 }
 
 func (z *ZstdFile) Size() (int64, error) {
-	return z.seekable.Seek(0, io.SeekEnd)
+	return z.file.Size(), nil
 }
 
 func (z *ZstdFile) Lock(elock vfs.LockLevel) error {
 	return nil
 }
 
+// SetDB receives the connection that opened the file. Reads from remote
+// sources then stop when the connection's interrupt context is done, such
+// as when the context of a database/sql query is canceled.
+func (z *ZstdFile) SetDB(db any) {
+	if conn, ok := db.(*sqlite3.Conn); ok {
+		z.conn = conn
+	}
+}
+
 func (z *ZstdFile) ReadAt(p []byte, off int64) (int, error) {
-	return z.seekable.ReadAt(p, off)
+	ctx := context.Background()
+	if z.conn != nil {
+		ctx = z.conn.GetInterrupt()
+	}
+
+	n, err := z.file.ReadAtContext(ctx, p, off)
+	if err != nil && err != io.EOF {
+		return n, systemError(err, core.ReadErrorCode(err))
+	}
+	return n, err
 }
 
 func (z *ZstdFile) SectorSize() int {
@@ -156,6 +139,26 @@ func (z *ZstdFile) WriteAt(p []byte, off int64) (int, error) {
 	return 0, sqlite3.IOERR_WRITE
 }
 
+// systemError tags err with the SQLite error code for code. For CANTOPEN
+// and IOERR codes, the driver keeps err as the cause of the resulting
+// *sqlite3.Error until the next VFS call.
+func systemError(err error, code core.Code) error {
+	switch code {
+	case core.CodeIOErrRead:
+		return vfs.SystemError(err, sqlite3.IOERR_READ)
+	case core.CodeIOErrShortRead:
+		return vfs.SystemError(err, sqlite3.IOERR_SHORT_READ)
+	case core.CodeCorrupt:
+		return vfs.SystemError(err, sqlite3.CORRUPT)
+	case core.CodeAuth:
+		return vfs.SystemError(err, sqlite3.AUTH)
+	case core.CodeInterrupt:
+		return vfs.SystemError(err, sqlite3.INTERRUPT)
+	default:
+		return vfs.SystemError(err, sqlite3.CANTOPEN)
+	}
+}
+
 var once = sync.OnceValue(func() error {
 	vfs.Register("zstd", &ZstdVFS{})
 	return nil
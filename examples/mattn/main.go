@@ -1,3 +1,5 @@
+//go:build cgo
+
 // Example usage with mattn/go-sqlite3 driver (CGO-based, traditional)
 // Note: Requires CGO to be enabled
 package main
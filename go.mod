@@ -2,24 +2,41 @@ module github.com/paulstuart/sqlitezstd
 
 go 1.25.4
 
-require github.com/SaveTheRbtz/zstd-seekable-format-go/cmd/zstdseek v0.8.0
+require (
+	github.com/SaveTheRbtz/zstd-seekable-format-go/pkg v0.8.0
+	github.com/brianvoe/gofakeit/v7 v7.12.1
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/georgysavva/scany/v2 v2.1.4
+	github.com/klauspost/compress v1.18.2
+	github.com/mattn/go-sqlite3 v1.14.32
+	github.com/ncruces/go-sqlite3 v0.30.3
+	github.com/psanford/sqlite3vfs v0.0.0-20251127171934-4e34e03a991a
+	github.com/stretchr/testify v1.11.1
+	modernc.org/libc v1.66.10
+	// driver/modernc reads the sqlite3 handle from the unexported db field
+	// of the driver's connection, which v1.40.1 has; its TestHandle fails
+	// if an upgrade removes it.
+	modernc.org/sqlite v1.40.1
+)
 
 require (
-	github.com/SaveTheRbtz/fastcdc-go v0.3.0 // indirect
-	github.com/SaveTheRbtz/zstd-seekable-format-go/pkg v0.8.0 // indirect
-	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/google/btree v1.1.3 // indirect
-	github.com/klauspost/compress v1.18.2 // indirect
-	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
-	github.com/rivo/uniseg v0.4.7 // indirect
-	github.com/schollz/progressbar/v3 v3.18.0 // indirect
-	github.com/stretchr/testify v1.11.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/ncruces/julianday v1.0.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	github.com/tetratelabs/wazero v1.10.1 // indirect
 	go.uber.org/atomic v1.11.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.27.1 // indirect
+	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
 	golang.org/x/sync v0.19.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
-	golang.org/x/term v0.38.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+	modernc.org/mathutil v1.7.1 // indirect
+	modernc.org/memory v1.11.0 // indirect
 )
-
-tool github.com/SaveTheRbtz/zstd-seekable-format-go/cmd/zstdseek
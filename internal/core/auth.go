@@ -0,0 +1,160 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Auth authorizes the requests of the built-in HTTP source. Every field
+// that is set is applied to each request, in order, so a Token replaces
+// the basic authentication and Credentials may replace either.
+type Auth struct {
+	// Header holds fields added to every request, such as an API key.
+	Header http.Header
+
+	// Username and Password are sent with HTTP basic authentication if
+	// Username is set.
+	Username string
+	Password string
+
+	// Token is sent as a bearer token if set.
+	Token string
+
+	// Credentials, if set, supplies header fields for every request.
+	Credentials CredentialsProvider
+}
+
+// CredentialsProvider supplies the header fields, typically
+// Authorization, that authorize requests to a remote source. It is asked
+// again with refresh set when a request is refused with 401 Unauthorized,
+// and should then return new credentials instead of cached ones; the
+// request is retried once with them. Credentials is called concurrently.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context, refresh bool) (http.Header, error)
+}
+
+// CredentialsFunc adapts a function to a CredentialsProvider.
+type CredentialsFunc func(ctx context.Context, refresh bool) (http.Header, error)
+
+// Credentials implements CredentialsProvider.
+func (f CredentialsFunc) Credentials(ctx context.Context, refresh bool) (http.Header, error) {
+	return f(ctx, refresh)
+}
+
+// WithAuth authorizes the requests for the database with auth instead of
+// the Auth registered for its URL or host.
+func WithAuth(auth Auth) Option {
+	return func(c *config) {
+		c.auth = &auth
+	}
+}
+
+var (
+	authsMu sync.RWMutex
+	auths   = map[string]Auth{}
+)
+
+// RegisterAuth authorizes the requests for the databases matching pattern
+// with auth. pattern is either the URL of a database or a host, with or
+// without a port. A URL takes precedence over a host with a port, which
+// takes precedence over a host without one. It replaces any Auth
+// previously registered for pattern; a nil auth removes it, so that a
+// less specific pattern applies again.
+func RegisterAuth(pattern string, auth *Auth) {
+	authsMu.Lock()
+	defer authsMu.Unlock()
+	if auth == nil {
+		delete(auths, hostPattern(pattern))
+		return
+	}
+	auths[hostPattern(pattern)] = *auth
+}
+
+// hostPattern normalizes a pattern given to RegisterAuth or
+// RegisterHTTPClient. Hosts are case insensitive.
+func hostPattern(pattern string) string {
+	if strings.Contains(pattern, "://") {
+		return pattern
+	}
+	return strings.ToLower(pattern)
+}
+
+// authFor returns the Auth registered for the database at name.
+func authFor(name string) (Auth, bool) {
+	authsMu.RLock()
+	defer authsMu.RUnlock()
+	return matchHost(auths, name)
+}
+
+// matchHost returns the value registered in m for the database at name,
+// under its URL, its host with the port, or its host alone, in that order
+// of precedence.
+func matchHost[T any](m map[string]T, name string) (T, bool) {
+	if v, ok := m[name]; ok {
+		return v, true
+	}
+	var zero T
+	u, err := url.Parse(name)
+	if err != nil {
+		return zero, false
+	}
+	if v, ok := m[strings.ToLower(u.Host)]; ok {
+		return v, true
+	}
+	v, ok := m[strings.ToLower(u.Hostname())]
+	return v, ok
+}
+
+type authKey struct{}
+
+// withAuth returns a copy of ctx carrying auth, which the built-in HTTP
+// source uses instead of the registered Auth.
+func withAuth(ctx context.Context, auth *Auth) context.Context {
+	return context.WithValue(ctx, authKey{}, auth)
+}
+
+// authFrom returns the Auth for the database at name: the one carried by
+// ctx, or else the registered one.
+func authFrom(ctx context.Context, name string) Auth {
+	if auth, ok := ctx.Value(authKey{}).(*Auth); ok {
+		return *auth
+	}
+	auth, _ := authFor(name)
+	return auth
+}
+
+// authorize sets the fields of auth on req. refresh is passed on to the
+// CredentialsProvider.
+func (a *Auth) authorize(ctx context.Context, req *http.Request, refresh bool) error {
+	setHeader(req.Header, a.Header)
+	if a.Username != "" {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+	if a.Credentials == nil {
+		return nil
+	}
+
+	header, err := a.Credentials.Credentials(ctx, refresh)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	setHeader(req.Header, header)
+	return nil
+}
+
+// setHeader replaces the fields of dst that src holds.
+func setHeader(dst, src http.Header) {
+	for key, values := range src {
+		dst.Del(key)
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authServer serves compressed over HTTP to the requests authorized
+// reports true for, and refuses the others with 401 Unauthorized.
+func authServer(t *testing.T, compressed []byte, authorized func(r *http.Request) bool) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.ServeContent(w, r, "db.zst", time.Time{}, bytes.NewReader(compressed))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWithAuth(t *testing.T) {
+	data := testData(2 * frameSize)
+	compressed := compress(t, data)
+
+	for _, tc := range []struct {
+		name       string
+		auth       Auth
+		authorized func(r *http.Request) bool
+	}{
+		{
+			"header",
+			Auth{Header: http.Header{"X-Api-Key": {"secret"}}},
+			func(r *http.Request) bool { return r.Header.Get("X-Api-Key") == "secret" },
+		},
+		{
+			"basic",
+			Auth{Username: "user", Password: "secret"},
+			func(r *http.Request) bool {
+				user, password, ok := r.BasicAuth()
+				return ok && user == "user" && password == "secret"
+			},
+		},
+		{
+			"bearer",
+			Auth{Token: "secret"},
+			func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer secret" },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := authServer(t, compressed, tc.authorized)
+
+			_, err := Open(t.Context(), server.URL+"/db.zst")
+			require.Error(t, err)
+			assert.Equal(t, CodeAuth, OpenErrorCode(err))
+
+			file, err := Open(t.Context(), server.URL+"/db.zst", WithAuth(tc.auth), WithCacheSize(0))
+			require.NoError(t, err)
+			defer file.Close() //nolint: errcheck
+
+			buf := make([]byte, 16)
+			_, err = file.ReadAt(buf, frameSize)
+			require.NoError(t, err)
+			assert.Equal(t, data[frameSize:frameSize+16], buf)
+		})
+	}
+}
+
+func TestRegisterAuth(t *testing.T) {
+	compressed := compress(t, testData(2*frameSize))
+	server := authServer(t, compressed, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer "+strings.TrimPrefix(r.URL.Path, "/")
+	})
+	host := strings.TrimPrefix(server.URL, "http://")
+	hostname, _, _ := strings.Cut(host, ":")
+	t.Cleanup(func() {
+		authsMu.Lock()
+		defer authsMu.Unlock()
+		clear(auths)
+	})
+
+	// The most specific pattern applies.
+	RegisterAuth(hostname, &Auth{Token: "hostname"})
+	RegisterAuth(strings.ToUpper(host), &Auth{Token: "host"})
+	RegisterAuth(server.URL+"/url", &Auth{Token: "url"})
+
+	for _, path := range []string{"/host", "/url"} {
+		file, err := Open(t.Context(), server.URL+path)
+		require.NoError(t, err, path)
+		require.NoError(t, file.Close())
+	}
+
+	_, err := Open(t.Context(), server.URL+"/hostname")
+	require.Error(t, err)
+
+	// Removing the Auth of the host with its port makes the one of the
+	// host alone apply.
+	RegisterAuth(host, nil)
+	file, err := Open(t.Context(), server.URL+"/hostname")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	_, err = Open(t.Context(), server.URL+"/host")
+	require.Error(t, err)
+
+	// WithAuth takes precedence over every registered Auth.
+	file, err = Open(t.Context(), server.URL+"/option", WithAuth(Auth{Token: "option"}))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
+
+func TestCredentialsProviderRefresh(t *testing.T) {
+	data := testData(2 * frameSize)
+	var valid atomic.Value
+	valid.Store("first")
+	server := authServer(t, compress(t, data), func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer "+valid.Load().(string)
+	})
+
+	// The provider caches its token until asked to refresh it.
+	var mu sync.Mutex
+	var token string
+	var calls, refreshes atomic.Int64
+	provider := CredentialsFunc(func(_ context.Context, refresh bool) (http.Header, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls.Add(1)
+		if refresh {
+			refreshes.Add(1)
+		}
+		if refresh || token == "" {
+			token = valid.Load().(string)
+		}
+		return http.Header{"Authorization": {"Bearer " + token}}, nil
+	})
+
+	file, err := Open(t.Context(), server.URL+"/db.zst", WithAuth(Auth{Credentials: provider}), WithCacheSize(0))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+	assert.Zero(t, refreshes.Load())
+
+	// The token expires: the next read is refused once, then retried with
+	// a refreshed token.
+	valid.Store("second")
+	calls.Store(0)
+
+	buf := make([]byte, 16)
+	_, err = file.ReadAt(buf, frameSize)
+	require.NoError(t, err)
+	assert.Equal(t, data[frameSize:frameSize+16], buf)
+	assert.Equal(t, int64(2), calls.Load())
+	assert.Equal(t, int64(1), refreshes.Load())
+}
+
+func TestCredentialsProviderError(t *testing.T) {
+	server := authServer(t, compress(t, testData(frameSize)), func(*http.Request) bool { return false })
+
+	errNoToken := errors.New("no token")
+	provider := CredentialsFunc(func(context.Context, bool) (http.Header, error) {
+		return nil, errNoToken
+	})
+
+	_, err := Open(t.Context(), server.URL+"/db.zst", WithAuth(Auth{Credentials: provider}))
+	require.ErrorIs(t, err, errNoToken)
+}
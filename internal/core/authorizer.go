@@ -0,0 +1,67 @@
+package core
+
+// Authorizer decides whether a statement being prepared may perform
+// action, as SQLite's sqlite3_set_authorizer callback does. arg1 and arg2
+// depend on the action: for ActionRead they are the table and column
+// names, for ActionFunction arg1 is empty and arg2 is the function name.
+// database is the name of the schema, such as "main", and trigger the
+// innermost trigger or view responsible for the access, if any; drivers
+// that do not report it pass an empty string.
+type Authorizer func(action AuthorizerAction, arg1, arg2, database, trigger string) AuthorizerResult
+
+// AuthorizerAction is a SQLite authorizer action code.
+type AuthorizerAction int
+
+// The authorizer action codes, with the SQLite values the drivers pass
+// through unchanged.
+const (
+	ActionCreateIndex       AuthorizerAction = 1
+	ActionCreateTable       AuthorizerAction = 2
+	ActionCreateTempIndex   AuthorizerAction = 3
+	ActionCreateTempTable   AuthorizerAction = 4
+	ActionCreateTempTrigger AuthorizerAction = 5
+	ActionCreateTempView    AuthorizerAction = 6
+	ActionCreateTrigger     AuthorizerAction = 7
+	ActionCreateView        AuthorizerAction = 8
+	ActionDelete            AuthorizerAction = 9
+	ActionDropIndex         AuthorizerAction = 10
+	ActionDropTable         AuthorizerAction = 11
+	ActionDropTempIndex     AuthorizerAction = 12
+	ActionDropTempTable     AuthorizerAction = 13
+	ActionDropTempTrigger   AuthorizerAction = 14
+	ActionDropTempView      AuthorizerAction = 15
+	ActionDropTrigger       AuthorizerAction = 16
+	ActionDropView          AuthorizerAction = 17
+	ActionInsert            AuthorizerAction = 18
+	ActionPragma            AuthorizerAction = 19
+	ActionRead              AuthorizerAction = 20
+	ActionSelect            AuthorizerAction = 21
+	ActionTransaction       AuthorizerAction = 22
+	ActionUpdate            AuthorizerAction = 23
+	ActionAttach            AuthorizerAction = 24
+	ActionDetach            AuthorizerAction = 25
+	ActionAlterTable        AuthorizerAction = 26
+	ActionReindex           AuthorizerAction = 27
+	ActionAnalyze           AuthorizerAction = 28
+	ActionCreateVTable      AuthorizerAction = 29
+	ActionDropVTable        AuthorizerAction = 30
+	ActionFunction          AuthorizerAction = 31
+	ActionSavepoint         AuthorizerAction = 32
+	ActionRecursive         AuthorizerAction = 33
+)
+
+// AuthorizerResult is the decision of an Authorizer.
+type AuthorizerResult int
+
+const (
+	// AuthorizerOK allows the action.
+	AuthorizerOK AuthorizerResult = 0
+
+	// AuthorizerDeny fails the statement with SQLITE_AUTH, "not
+	// authorized".
+	AuthorizerDeny AuthorizerResult = 1
+
+	// AuthorizerIgnore prepares the statement without the action: a column
+	// read returns NULL, and other actions are skipped.
+	AuthorizerIgnore AuthorizerResult = 2
+)
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultCacheSize is the default budget, in decompressed bytes, of the
+// frame cache shared by every open File.
+const DefaultCacheSize = 32 << 20
+
+// frames is the process-wide cache of decompressed frames.
+var frames = newFrameCache(DefaultCacheSize)
+
+// SetCacheSize sets the budget, in decompressed bytes, of the frame cache
+// shared by every open File, evicting the least recently used frames if
+// the cache is over the new budget. A size of 0 disables the cache.
+func SetCacheSize(size int64) {
+	frames.resize(size)
+}
+
+// WithCacheSize gives the database a frame cache of its own holding up to
+// size decompressed bytes, instead of the process-wide cache. Files opened
+// on the same source with this option share that cache, sized by the most
+// recent of them. A size of 0 disables caching for the File.
+func WithCacheSize(size int64) Option {
+	return func(c *config) {
+		c.cacheSize = &size
+	}
+}
+
+// databaseCache is a frame cache dedicated to one source. It is dropped
+// when the last File using it closes.
+type databaseCache struct {
+	*frameCache
+	id   string
+	refs int
+}
+
+var (
+	databaseCachesMu sync.Mutex
+	databaseCaches   = map[string]*databaseCache{}
+)
+
+// acquireDatabaseCache returns the cache dedicated to the source id,
+// creating it or resizing it to size.
+func acquireDatabaseCache(id string, size int64) *databaseCache {
+	databaseCachesMu.Lock()
+	defer databaseCachesMu.Unlock()
+
+	c, ok := databaseCaches[id]
+	if ok {
+		c.resize(size)
+	} else {
+		c = &databaseCache{frameCache: newFrameCache(size), id: id}
+		databaseCaches[id] = c
+	}
+	c.refs++
+	return c
+}
+
+// releaseDatabaseCache gives up a reference to c, dropping it once no open
+// File uses it.
+func releaseDatabaseCache(c *databaseCache) {
+	databaseCachesMu.Lock()
+	defer databaseCachesMu.Unlock()
+
+	c.refs--
+	if c.refs == 0 {
+		delete(databaseCaches, c.id)
+	}
+}
+
+// identifier is implemented by sources that can name the bytes they serve
+// more precisely than their database name, e.g. by including a
+// modification time, so that a replaced file is not served from stale
+// cache entries.
+type identifier interface {
+	identity() string
+}
+
+// sourceIdentity returns the cache identity of the compressed bytes served
+// by source. Sources opened from the same name with the same size share
+// cached frames unless the source implements identifier.
+func sourceIdentity(name string, source io.ReaderAt, size int64) string {
+	if id, ok := source.(identifier); ok {
+		return id.identity()
+	}
+	return fmt.Sprintf("%s#%d", name, size)
+}
+
+// frameKey identifies a decompressed frame across all open Files.
+type frameKey struct {
+	source string
+	frame  int64
+}
+
+// frameCache is a least-recently-used cache of decompressed frames bounded
+// by their total size.
+type frameCache struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	order   *list.List // of *frameEntry, most recently used first
+	entries map[frameKey]*list.Element
+}
+
+type frameEntry struct {
+	key  frameKey
+	data []byte
+}
+
+func newFrameCache(maxSize int64) *frameCache {
+	return &frameCache{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[frameKey]*list.Element),
+	}
+}
+
+// get returns the cached frame for key and marks it as recently used.
+func (c *frameCache) get(key frameKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*frameEntry).data, true
+}
+
+// contains reports whether key is cached, without marking it as used.
+func (c *frameCache) contains(key frameKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.entries[key]
+	return ok
+}
+
+// enabled reports whether the cache can hold any frame.
+func (c *frameCache) enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.maxSize > 0
+}
+
+// add caches data under key. Frames larger than the whole budget are not
+// cached.
+func (c *frameCache) add(key frameKey, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if int64(len(data)) > c.maxSize {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&frameEntry{key: key, data: data})
+	c.size += int64(len(data))
+	c.evict()
+}
+
+// resize changes the budget of the cache.
+func (c *frameCache) resize(maxSize int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxSize = max(maxSize, 0)
+	c.evict()
+}
+
+// evict drops the least recently used frames until the cache fits its
+// budget. c.mu must be held.
+func (c *frameCache) evict() {
+	for c.size > c.maxSize {
+		elem := c.order.Back()
+		entry := elem.Value.(*frameEntry)
+		c.order.Remove(elem)
+		delete(c.entries, entry.key)
+		c.size -= int64(len(entry.data))
+	}
+}
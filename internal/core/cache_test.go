@@ -0,0 +1,126 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingReader counts the reads made against a source.
+type countingReader struct {
+	*bytes.Reader
+	reads atomic.Int64
+}
+
+func (r *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	r.reads.Add(1)
+	return r.Reader.ReadAt(p, off)
+}
+
+func TestFrameCacheEviction(t *testing.T) {
+	cache := newFrameCache(3 * frameSize)
+	frame := make([]byte, frameSize)
+
+	for i := range int64(3) {
+		cache.add(frameKey{source: "a", frame: i}, frame)
+	}
+
+	// Touch frame 0 so that frame 1 is the least recently used.
+	_, ok := cache.get(frameKey{source: "a", frame: 0})
+	require.True(t, ok)
+
+	cache.add(frameKey{source: "a", frame: 3}, frame)
+	assert.EqualValues(t, 3*frameSize, cache.size)
+
+	_, ok = cache.get(frameKey{source: "a", frame: 1})
+	assert.False(t, ok)
+	for _, i := range []int64{0, 2, 3} {
+		_, ok = cache.get(frameKey{source: "a", frame: i})
+		assert.True(t, ok, "frame %d", i)
+	}
+
+	cache.add(frameKey{source: "b", frame: 0}, make([]byte, 4*frameSize))
+	_, ok = cache.get(frameKey{source: "b", frame: 0})
+	assert.False(t, ok, "frames larger than the budget are not cached")
+
+	cache.resize(0)
+	assert.Zero(t, cache.size)
+	assert.Empty(t, cache.entries)
+}
+
+func TestCacheSharedAcrossFiles(t *testing.T) {
+	data := testData(8 * frameSize)
+	source := &countingReader{Reader: bytes.NewReader(compress(t, data))}
+
+	name := registerReader(t, source, source.Size())
+
+	read := func() {
+		file, err := Open(t.Context(), name)
+		require.NoError(t, err)
+		defer file.Close() //nolint: errcheck
+
+		got := make([]byte, len(data))
+		_, err = file.ReadAt(got, 0)
+		require.NoError(t, err)
+		assert.Equal(t, data, got)
+	}
+
+	read()
+	first := source.reads.Load()
+
+	// Everything but the seek table comes from the cache the second time.
+	read()
+	assert.Equal(t, int64(2), source.reads.Load()-first)
+}
+
+func TestCacheDisabled(t *testing.T) {
+	SetCacheSize(0)
+	defer SetCacheSize(DefaultCacheSize)
+
+	data := testData(4 * frameSize)
+	source := &countingReader{Reader: bytes.NewReader(compress(t, data))}
+
+	name := registerReader(t, source, source.Size())
+
+	file, err := Open(t.Context(), name)
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	// Repeated reads of one frame decompress it once.
+	page := make([]byte, 512)
+	before := source.reads.Load()
+	for off := int64(0); off < frameSize; off += int64(len(page)) {
+		_, err = file.ReadAt(page, off)
+		require.NoError(t, err)
+		assert.Equal(t, data[off:off+int64(len(page))], page)
+	}
+	assert.Equal(t, int64(1), source.reads.Load()-before)
+
+	// Other frames are read again every time they are needed.
+	_, err = file.ReadAt(page, frameSize)
+	require.NoError(t, err)
+	_, err = file.ReadAt(page, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), source.reads.Load()-before)
+}
+
+func TestReadAtEOF(t *testing.T) {
+	data := testData(2*frameSize + 100)
+	compressed := compress(t, data)
+
+	name := registerCompressed(t, compressed)
+
+	file, err := Open(t.Context(), name)
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	got := make([]byte, 200)
+	n, err := file.ReadAt(got, int64(len(data))-100)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, data[len(data)-100:], got[:n])
+}
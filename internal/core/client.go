@@ -0,0 +1,122 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// httpClient is the client of the built-in HTTP source until SetHTTPClient
+// is called. Its transport is http.DefaultTransport with a dialer that
+// honors WithConnectTimeout.
+var httpClient = NewHTTPClient(nil)
+
+// defaultHTTPClient is the client set by SetHTTPClient.
+var defaultHTTPClient atomic.Pointer[http.Client]
+
+// NewHTTPClient returns a client like the one the built-in HTTP source uses
+// by default, which honors WithConnectTimeout, with tlsConfig as the TLS
+// configuration of its transport, e.g. to trust a private CA with RootCAs
+// or to present a client certificate with Certificates. A nil tlsConfig
+// keeps the default one.
+func NewHTTPClient(tlsConfig *tls.Config) *http.Client {
+	transport := newHTTPTransport()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Transport: transport}
+}
+
+func newHTTPTransport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if timeout, ok := ctx.Value(connectTimeoutKey{}).(time.Duration); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return transport
+}
+
+type connectTimeoutKey struct{}
+
+// withConnectTimeout returns a copy of ctx that bounds the connections
+// dialed by clients from NewHTTPClient for requests made with it.
+func withConnectTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, connectTimeoutKey{}, timeout)
+}
+
+// SetHTTPClient sets the client of the built-in HTTP source for the
+// databases opened afterwards without WithHTTPClient or a client
+// registered with RegisterHTTPClient. A nil client, the default, selects
+// the built-in one. Clients that do not come from NewHTTPClient do not
+// honor WithConnectTimeout; their own dialer timeout applies instead.
+func SetHTTPClient(client *http.Client) {
+	defaultHTTPClient.Store(client)
+}
+
+// WithHTTPClient makes the built-in HTTP source request the database with
+// client instead of the client registered for its URL or host, or the one
+// set by SetHTTPClient. It is how requests go through a proxy, trust a
+// private CA, present a client certificate, or limit their connections.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.client = client
+	}
+}
+
+var (
+	httpClientsMu sync.RWMutex
+	httpClients   = map[string]*http.Client{}
+)
+
+// RegisterHTTPClient makes the built-in HTTP source request the databases
+// matching pattern with client. pattern is matched as by RegisterAuth. It
+// replaces any client previously registered for pattern; a nil client
+// removes it.
+func RegisterHTTPClient(pattern string, client *http.Client) {
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+	if client == nil {
+		delete(httpClients, hostPattern(pattern))
+		return
+	}
+	httpClients[hostPattern(pattern)] = client
+}
+
+type httpClientKey struct{}
+
+// withHTTPClient returns a copy of ctx carrying client, which the built-in
+// HTTP source uses instead of the registered one.
+func withHTTPClient(ctx context.Context, client *http.Client) context.Context {
+	return context.WithValue(ctx, httpClientKey{}, client)
+}
+
+// httpClientFrom returns the client for the database at name: the one
+// carried by ctx, else the registered one, else the one set by
+// SetHTTPClient, else the built-in one.
+func httpClientFrom(ctx context.Context, name string) *http.Client {
+	if client, ok := ctx.Value(httpClientKey{}).(*http.Client); ok {
+		return client
+	}
+
+	httpClientsMu.RLock()
+	client, ok := matchHost(httpClients, name)
+	httpClientsMu.RUnlock()
+	if ok {
+		return client
+	}
+
+	if client := defaultHTTPClient.Load(); client != nil {
+		return client
+	}
+	return httpClient
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tlsServer serves compressed over HTTPS. If clientCAs is set, the server
+// requires a client certificate issued by one of them.
+func tlsServer(t *testing.T, compressed []byte, clientCAs *x509.CertPool) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "db.zst", time.Time{}, bytes.NewReader(compressed))
+	}))
+	if clientCAs != nil {
+		server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// serverRoots returns a pool trusting the certificate of server.
+func serverRoots(server *httptest.Server) *x509.CertPool {
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return roots
+}
+
+// clientCertificate returns a self-signed client certificate, and a pool
+// trusting it.
+func clientCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
+}
+
+// countingTransport counts the requests it passes on to next.
+type countingTransport struct {
+	next     http.RoundTripper
+	requests atomic.Int64
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return c.next.RoundTrip(r)
+}
+
+func TestHTTPClientRootCAs(t *testing.T) {
+	data := testData(2 * frameSize)
+	server := tlsServer(t, compress(t, data), nil)
+	name := server.URL + "/db.zst"
+
+	// The test certificate is not trusted by default.
+	_, err := Open(t.Context(), name)
+	var unknownAuthority x509.UnknownAuthorityError
+	require.ErrorAs(t, err, &unknownAuthority)
+
+	client := NewHTTPClient(&tls.Config{RootCAs: serverRoots(server)})
+	file, err := Open(t.Context(), name, WithHTTPClient(client))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	buf := make([]byte, 16)
+	_, err = file.ReadAt(buf, frameSize)
+	require.NoError(t, err)
+	assert.Equal(t, data[frameSize:frameSize+16], buf)
+}
+
+func TestHTTPClientMutualTLS(t *testing.T) {
+	data := testData(2 * frameSize)
+	cert, clientCAs := clientCertificate(t)
+	server := tlsServer(t, compress(t, data), clientCAs)
+	name := server.URL + "/db.zst"
+
+	// The server refuses clients without a certificate.
+	_, err := Open(t.Context(), name, WithHTTPClient(NewHTTPClient(&tls.Config{RootCAs: serverRoots(server)})), WithRetryPolicy(RetryPolicy{}))
+	require.Error(t, err)
+
+	client := NewHTTPClient(&tls.Config{RootCAs: serverRoots(server), Certificates: []tls.Certificate{cert}})
+	file, err := Open(t.Context(), name, WithHTTPClient(client))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	buf := make([]byte, 16)
+	_, err = file.ReadAt(buf, frameSize)
+	require.NoError(t, err)
+	assert.Equal(t, data[frameSize:frameSize+16], buf)
+}
+
+func TestRegisterHTTPClient(t *testing.T) {
+	server := tlsServer(t, compress(t, testData(2*frameSize)), nil)
+	name := server.URL + "/db.zst"
+	t.Cleanup(func() {
+		httpClientsMu.Lock()
+		defer httpClientsMu.Unlock()
+		clear(httpClients)
+	})
+
+	registered := &countingTransport{next: NewHTTPClient(&tls.Config{RootCAs: serverRoots(server)}).Transport}
+	RegisterHTTPClient(server.Listener.Addr().String(), &http.Client{Transport: registered})
+
+	file, err := Open(t.Context(), name)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	assert.Positive(t, registered.requests.Load())
+
+	// WithHTTPClient takes precedence over the registered client.
+	before := registered.requests.Load()
+	file, err = Open(t.Context(), name, WithHTTPClient(NewHTTPClient(&tls.Config{RootCAs: serverRoots(server)})))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	assert.Equal(t, before, registered.requests.Load())
+
+	// Removing the registration falls back to the default client.
+	RegisterHTTPClient(server.Listener.Addr().String(), nil)
+	_, err = Open(t.Context(), name)
+	var unknownAuthority x509.UnknownAuthorityError
+	require.ErrorAs(t, err, &unknownAuthority)
+}
+
+func TestSetHTTPClient(t *testing.T) {
+	server := tlsServer(t, compress(t, testData(2*frameSize)), nil)
+	t.Cleanup(func() { SetHTTPClient(nil) })
+
+	SetHTTPClient(NewHTTPClient(&tls.Config{RootCAs: serverRoots(server)}))
+	file, err := Open(t.Context(), server.URL+"/db.zst")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
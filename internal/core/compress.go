@@ -0,0 +1,156 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+
+	seekable "github.com/SaveTheRbtz/zstd-seekable-format-go/pkg"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultPagesPerFrame is the number of database pages compressed into
+// each frame by CompressDB unless CompressOptions says otherwise.
+const DefaultPagesPerFrame = 16
+
+const (
+	// sqliteHeaderSize is the size of the header that starts every SQLite
+	// database.
+	sqliteHeaderSize = 100
+
+	// sqliteMagic starts the header of every SQLite database.
+	sqliteMagic = "SQLite format 3\x00"
+)
+
+// ErrNotSQLite reports a CompressDB source that does not start with a
+// SQLite database header.
+var ErrNotSQLite = errors.New("not a SQLite database")
+
+// CompressOptions configures CompressDB. The zero value selects the
+// defaults.
+type CompressOptions struct {
+	// PagesPerFrame is the number of database pages in each frame, or
+	// DefaultPagesPerFrame if 0. Smaller frames make reads of single pages
+	// cheaper, larger ones compress better.
+	PagesPerFrame int
+
+	// Level is the Zstandard compression level, from 1 to 22 as for the
+	// zstd command, or 3 if 0. Levels are mapped to the closest level the
+	// encoder implements.
+	Level int
+
+	// Concurrency is the number of frames compressed in parallel, or
+	// GOMAXPROCS if 0.
+	Concurrency int
+}
+
+// CompressDB compresses the SQLite database read from src into the
+// seekable format, written to dst. Frames hold a whole number of pages, of
+// the size read from the database header, so that reading a page never
+// decompresses two frames. Compression stops with the error of ctx once it
+// is done.
+func CompressDB(ctx context.Context, src io.Reader, dst io.Writer, opts CompressOptions) error {
+	pagesPerFrame := opts.PagesPerFrame
+	if pagesPerFrame == 0 {
+		pagesPerFrame = DefaultPagesPerFrame
+	}
+	concurrency := opts.Concurrency
+	if concurrency == 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	switch {
+	case pagesPerFrame < 0:
+		return fmt.Errorf("negative pages per frame: %d", pagesPerFrame)
+	case opts.Level < 0 || opts.Level > 22:
+		return fmt.Errorf("compression level %d out of range 1-22", opts.Level)
+	case concurrency < 0:
+		return fmt.Errorf("negative concurrency: %d", concurrency)
+	}
+
+	header := make([]byte, sqliteHeaderSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: too short", ErrNotSQLite)
+		}
+		return err
+	}
+	pageSize, err := sqlitePageSize(header)
+	if err != nil {
+		return err
+	}
+	if pagesPerFrame > maxFrameSize/pageSize {
+		return fmt.Errorf("%d pages of %d bytes exceed the maximum frame size", pagesPerFrame, pageSize)
+	}
+
+	level := zstd.SpeedDefault
+	if opts.Level > 0 {
+		level = zstd.EncoderLevelFromZstd(opts.Level)
+	}
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(concurrency))
+	if err != nil {
+		return err
+	}
+	defer encoder.Close() //nolint: errcheck
+
+	writer, err := seekable.NewWriter(dst, encoder)
+	if err != nil {
+		return err
+	}
+
+	src = io.MultiReader(bytes.NewReader(header), src)
+	frameSize := pagesPerFrame * pageSize
+	err = writer.WriteMany(ctx, func() ([]byte, error) {
+		frame := make([]byte, frameSize)
+		n, err := io.ReadFull(src, frame)
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil, nil
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return frame[:n], nil
+		}
+		return frame, err
+	}, seekable.WithConcurrency(concurrency))
+	if err == nil {
+		// WriteMany stops without an error when ctx is done.
+		err = ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// PageSize returns the page size recorded in the header of the SQLite
+// database read from r, such as a File.
+func PageSize(r io.ReaderAt) (int, error) {
+	header := make([]byte, sqliteHeaderSize)
+	if n, err := r.ReadAt(header, 0); n < len(header) {
+		if errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("%w: too short", ErrNotSQLite)
+		}
+		return 0, fmt.Errorf("failed to read database header: %w", err)
+	}
+	return sqlitePageSize(header)
+}
+
+// sqlitePageSize returns the page size recorded in the database header.
+func sqlitePageSize(header []byte) (int, error) {
+	if string(header[:len(sqliteMagic)]) != sqliteMagic {
+		return 0, ErrNotSQLite
+	}
+
+	// The page size is a big-endian power of two from 512 to 32768, or 1
+	// for 65536.
+	pageSize := int(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return 0, fmt.Errorf("%w: invalid page size %d", ErrNotSQLite, pageSize)
+	}
+	return pageSize, nil
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabase returns an image of pages pages of pageSize bytes starting
+// with a SQLite header. Only the header is valid.
+func testDatabase(pageSize, pages int) []byte {
+	data := testData(pageSize * pages)
+	copy(data, sqliteMagic)
+	field := uint16(pageSize)
+	if pageSize == 65536 {
+		field = 1
+	}
+	binary.BigEndian.PutUint16(data[16:], field)
+	return data
+}
+
+func TestCompressDB(t *testing.T) {
+	t.Cleanup(func() { RegisterReaderAt("compressed", nil, 0) })
+
+	for _, tc := range []struct {
+		pageSize, pages int
+		opts            CompressOptions
+		frameSize       uint32
+	}{
+		{4096, 50, CompressOptions{}, DefaultPagesPerFrame * 4096},
+		{1024, 10, CompressOptions{PagesPerFrame: 3, Level: 19, Concurrency: 1}, 3 * 1024},
+		{65536, 3, CompressOptions{PagesPerFrame: 1, Level: 1, Concurrency: 4}, 65536},
+	} {
+		db := testDatabase(tc.pageSize, tc.pages)
+		var out bytes.Buffer
+		require.NoError(t, CompressDB(t.Context(), bytes.NewReader(db), &out, tc.opts))
+
+		RegisterReaderAt("compressed", bytes.NewReader(out.Bytes()), int64(out.Len()))
+		file, err := Open(t.Context(), "compressed")
+		require.NoError(t, err)
+		scan(t, file, db)
+		assert.EqualValues(t, out.Len(), file.CompressedSize())
+		assert.True(t, file.Checksums())
+
+		// Every frame but the last holds whole pages.
+		frames := file.Frames()
+		require.NotEmpty(t, frames)
+		var offset int64
+		for i, frame := range frames {
+			assert.Equal(t, offset, frame.Offset, i)
+			if i < len(frames)-1 {
+				assert.EqualValues(t, tc.frameSize, frame.Size, i)
+			}
+			offset += frame.Size
+		}
+		assert.EqualValues(t, len(db), offset)
+		require.NoError(t, file.Close())
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	for _, pageSize := range []int{512, 4096, 65536} {
+		pageSizeOf, err := PageSize(bytes.NewReader(testDatabase(pageSize, 2)))
+		require.NoError(t, err)
+		assert.Equal(t, pageSize, pageSizeOf)
+	}
+
+	_, err := PageSize(bytes.NewReader([]byte(sqliteMagic)))
+	require.ErrorIs(t, err, ErrNotSQLite)
+
+	_, err = PageSize(bytes.NewReader(testData(4096)))
+	require.ErrorIs(t, err, ErrNotSQLite)
+}
+
+func TestCompressDBError(t *testing.T) {
+	var out bytes.Buffer
+	err := CompressDB(t.Context(), bytes.NewReader(testData(4096)), &out, CompressOptions{})
+	require.ErrorIs(t, err, ErrNotSQLite)
+
+	err = CompressDB(t.Context(), bytes.NewReader([]byte(sqliteMagic)), &out, CompressOptions{})
+	require.ErrorIs(t, err, ErrNotSQLite)
+
+	db := testDatabase(4096, 4)
+	binary.BigEndian.PutUint16(db[16:], 1000)
+	err = CompressDB(t.Context(), bytes.NewReader(db), &out, CompressOptions{})
+	require.ErrorContains(t, err, "invalid page size 1000")
+
+	err = CompressDB(t.Context(), bytes.NewReader(testDatabase(4096, 4)), &out, CompressOptions{Level: 23})
+	require.ErrorContains(t, err, "out of range")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	err = CompressDB(ctx, bytes.NewReader(testDatabase(4096, 64)), &out, CompressOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+}
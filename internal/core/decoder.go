@@ -0,0 +1,89 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// WithDecoderConcurrency limits the number of frames a File's decoder
+// decompresses at the same time. Files opened with the same decoder limits
+// share a decoder. The default is the zstd package's default.
+func WithDecoderConcurrency(n int) Option {
+	return func(c *config) {
+		c.decoder.concurrency = n
+	}
+}
+
+// WithDecoderMaxMemory limits the size a single frame may decompress to.
+// Frames that exceed it fail to read. The default is the zstd package's
+// default.
+func WithDecoderMaxMemory(n uint64) Option {
+	return func(c *config) {
+		c.decoder.maxMemory = n
+	}
+}
+
+// decoderKey holds the limits a decoder was created with. Files opened
+// with the same limits share a decoder.
+type decoderKey struct {
+	concurrency int
+	maxMemory   uint64
+}
+
+// sharedDecoder is a decoder shared by every open File with the same
+// limits. It is closed when the last of those Files closes.
+type sharedDecoder struct {
+	*zstd.Decoder
+	key  decoderKey
+	refs int
+}
+
+var (
+	decodersMu sync.Mutex
+	decoders   = map[decoderKey]*sharedDecoder{}
+)
+
+// acquireDecoder returns the decoder for key, creating it if no open File
+// is using one.
+func acquireDecoder(key decoderKey) (*sharedDecoder, error) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	if d, ok := decoders[key]; ok {
+		d.refs++
+		return d, nil
+	}
+
+	opts := []zstd.DOption{}
+	if key.concurrency > 0 {
+		opts = append(opts, zstd.WithDecoderConcurrency(key.concurrency))
+	}
+	if key.maxMemory > 0 {
+		opts = append(opts, zstd.WithDecoderMaxMemory(key.maxMemory))
+	}
+
+	decoder, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decoder: %w", err)
+	}
+
+	d := &sharedDecoder{Decoder: decoder, key: key, refs: 1}
+	decoders[key] = d
+	return d, nil
+}
+
+// releaseDecoder gives up a reference to d, closing it once no open File
+// uses it.
+func releaseDecoder(d *sharedDecoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	d.refs--
+	if d.refs > 0 {
+		return
+	}
+	delete(decoders, d.key)
+	d.Close()
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoderShared(t *testing.T) {
+	compressed := compress(t, testData(4*frameSize))
+	name := registerCompressed(t, compressed)
+
+	key := decoderKey{concurrency: 3}
+	first, err := Open(t.Context(), name, WithDecoderConcurrency(3))
+	require.NoError(t, err)
+	second, err := Open(t.Context(), name, WithDecoderConcurrency(3))
+	require.NoError(t, err)
+	other, err := Open(t.Context(), name, WithDecoderConcurrency(3), WithDecoderMaxMemory(1<<20))
+	require.NoError(t, err)
+
+	assert.Same(t, first.decoder, second.decoder)
+	assert.NotSame(t, first.decoder, other.decoder)
+	assert.Equal(t, 2, first.decoder.refs)
+
+	require.NoError(t, first.Close())
+	require.NoError(t, first.Close())
+	assert.Equal(t, 1, second.decoder.refs)
+
+	require.NoError(t, second.Close())
+	require.NoError(t, other.Close())
+
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	assert.NotContains(t, decoders, key)
+	assert.Empty(t, decoders)
+}
+
+func TestDecoderMaxMemory(t *testing.T) {
+	compressed := compress(t, testData(4*frameSize))
+	name := registerCompressed(t, compressed)
+
+	file, err := Open(t.Context(), name, WithDecoderMaxMemory(frameSize/2))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	_, err = file.ReadAt(make([]byte, 16), 0)
+	var corrupt *ErrCorruptFrame
+	require.ErrorAs(t, err, &corrupt)
+	assert.EqualValues(t, 0, corrupt.Index)
+}
+
+func TestOpenCloseDoesNotLeak(t *testing.T) {
+	compressed := compress(t, testData(4*frameSize))
+	name := registerCompressed(t, compressed)
+
+	before := runtime.NumGoroutine()
+
+	page := make([]byte, 512)
+	for range 10_000 {
+		file, err := Open(t.Context(), name, WithDecoderConcurrency(4))
+		require.NoError(t, err)
+		_, err = file.ReadAt(page, frameSize)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+	}
+
+	// Decoder goroutines exit asynchronously after Close.
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	assert.Empty(t, decoders)
+}
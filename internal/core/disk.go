@@ -0,0 +1,302 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// DefaultDiskCacheSize is the budget, in bytes, of a disk cache enabled
+// without one.
+const DefaultDiskCacheSize = 1 << 30
+
+const (
+	// diskTempPrefix starts the names of entries being written.
+	diskTempPrefix = ".tmp-"
+
+	// diskTempMaxAge is the age past which an entry still being written is
+	// taken to be left over by a process that died, and removed.
+	diskTempMaxAge = time.Hour
+
+	// diskHeaderSize is the size of the xxhash of the data that starts
+	// every entry.
+	diskHeaderSize = 8
+)
+
+// defaultDiskCache is the disk cache set by SetDiskCache.
+var defaultDiskCache atomic.Pointer[diskCache]
+
+// SetDiskCache stores the compressed bytes read from the remote sources of
+// the databases opened afterwards without WithDiskCache in dir, holding up
+// to maxSize bytes. An empty dir, the default, disables the disk cache.
+func SetDiskCache(dir string, maxSize int64) {
+	if dir == "" {
+		defaultDiskCache.Store(nil)
+		return
+	}
+	defaultDiskCache.Store(diskCacheFor(dir, maxSize))
+}
+
+// WithDiskCache stores the compressed bytes read from the remote source of
+// the database in dir, holding up to maxSize bytes, or
+// DefaultDiskCacheSize if maxSize is 0, so that they are not fetched again
+// by later opens, in this process or another. Entries are keyed by the
+// identity of the source, its URL, size and ETag or Last-Modified time,
+// and the least recently used are evicted. Processes may share dir. An
+// empty dir disables the disk cache set by SetDiskCache. Only remote
+// sources served with an ETag or Last-Modified time are cached: local
+// files, the files of filesystems registered by RegisterFS, readers
+// registered by RegisterReaderAt and sources registered by RegisterSource
+// never are. It is the zstd_disk_cache URI parameter, and maxSize the
+// zstd_disk_cache_size one.
+func WithDiskCache(dir string, maxSize int64) Option {
+	return func(c *config) {
+		c.diskDir = &dir
+		c.diskSize = maxSize
+	}
+}
+
+// withDiskCacheSize returns the Option of the zstd_disk_cache_size URI
+// parameter, which changes the budget of the disk cache.
+func withDiskCacheSize(maxSize int64) Option {
+	return func(c *config) {
+		c.diskSize = maxSize
+	}
+}
+
+// diskCache is a directory of compressed byte ranges read from remote
+// sources. Each range is a file named after a hash of its source identity,
+// offset and length, holding the xxhash of the range followed by the
+// range. Files are written under a temporary name and renamed into place,
+// so that other processes never see them partially written, and their
+// modification time is refreshed on every hit, which orders the eviction
+// of the least recently used. Sizes are tracked per process and
+// reconciled with the directory whenever it seems full, so the budget is
+// approximate when several processes share dir.
+type diskCache struct {
+	dir     string
+	maxSize atomic.Int64
+
+	mu   sync.Mutex
+	size int64 // -1 until the directory is scanned
+}
+
+var (
+	diskCachesMu sync.Mutex
+	diskCaches   = map[string]*diskCache{}
+)
+
+// diskCacheFor returns the disk cache of dir, creating it or resizing it
+// to maxSize.
+func diskCacheFor(dir string, maxSize int64) *diskCache {
+	if maxSize <= 0 {
+		maxSize = DefaultDiskCacheSize
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	diskCachesMu.Lock()
+	defer diskCachesMu.Unlock()
+
+	c, ok := diskCaches[dir]
+	if !ok {
+		c = &diskCache{dir: dir, size: -1}
+		diskCaches[dir] = c
+	}
+	c.maxSize.Store(maxSize)
+	return c
+}
+
+// disk returns the disk cache of the database configured by c, or nil if
+// it has none.
+func (c *config) disk() *diskCache {
+	switch {
+	case c.diskDir == nil:
+		return defaultDiskCache.Load()
+	case *c.diskDir == "":
+		return nil
+	default:
+		return diskCacheFor(*c.diskDir, c.diskSize)
+	}
+}
+
+// path returns the path of the range of length bytes at off of the source
+// id.
+func (c *diskCache) path(id string, off, length int64) string {
+	sum := sha256.Sum256([]byte(id + "\x00" + strconv.FormatInt(off, 10) + "\x00" + strconv.FormatInt(length, 10)))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// get fills buf with the range at off of the source id, and reports
+// whether it was cached. Entries that do not hold the range intact are
+// removed.
+func (c *diskCache) get(id string, buf []byte, off int64) bool {
+	path := c.path(id, off, int64(len(buf)))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if len(data) != diskHeaderSize+len(buf) || binary.LittleEndian.Uint64(data) != xxhash.Sum64(data[diskHeaderSize:]) {
+		_ = os.Remove(path)
+		return false
+	}
+
+	copy(buf, data[diskHeaderSize:])
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return true
+}
+
+// put stores data, the range at off of the source id, evicting the least
+// recently used entries if the cache is over its budget. Failures only
+// cost later fetches, so they are logged to logger and otherwise ignored.
+func (c *diskCache) put(id string, data []byte, off int64, logger *slog.Logger) {
+	if int64(len(data)) > c.maxSize.Load() {
+		return
+	}
+	if err := c.write(c.path(id, off, int64(len(data))), data); err != nil {
+		logger.Warn("failed to write disk cache", "dir", c.dir, "error", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size >= 0 {
+		c.size += diskHeaderSize + int64(len(data))
+	}
+	if c.size < 0 || c.size > c.maxSize.Load() {
+		if err := c.evict(); err != nil {
+			logger.Warn("failed to evict disk cache", "dir", c.dir, "error", err)
+		}
+	}
+}
+
+// write writes the entry at path atomically.
+func (c *diskCache) write(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), diskTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint: errcheck
+
+	header := binary.LittleEndian.AppendUint64(nil, xxhash.Sum64(data))
+	if _, err := tmp.Write(header); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// evict scans the directory, removing entries left over by writers that
+// died, and the least recently used entries until the cache fills at most
+// 90% of its budget. c.mu must be held.
+func (c *diskCache) evict() error {
+	type entry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var entries []entry
+	var size int64
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed by another process
+		}
+		if strings.HasPrefix(d.Name(), diskTempPrefix) {
+			if time.Since(info.ModTime()) > diskTempMaxAge {
+				_ = os.Remove(path)
+			}
+			return nil
+		}
+		entries = append(entries, entry{path, info.Size(), info.ModTime()})
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if maxSize := c.maxSize.Load(); size > maxSize {
+		slices.SortFunc(entries, func(a, b entry) int { return a.modTime.Compare(b.modTime) })
+		for _, e := range entries {
+			if size <= maxSize/10*9 {
+				break
+			}
+			if err := os.Remove(e.path); err == nil || errors.Is(err, fs.ErrNotExist) {
+				size -= e.size
+			}
+		}
+	}
+	c.size = size
+	return nil
+}
+
+// validator is implemented by sources that can tell whether they identified
+// the version opened with a validator, such as an ETag, and not only by its
+// size. Only those are kept in the disk cache.
+type validator interface {
+	validated() bool
+}
+
+// diskRanges is the part of a disk cache holding the ranges of one
+// version of a source, named by its identity, which includes its size.
+// Its methods do nothing if the cache is nil.
+type diskRanges struct {
+	cache  *diskCache
+	id     string
+	logger *slog.Logger
+}
+
+func (r diskRanges) get(buf []byte, off int64) bool {
+	return r.cache != nil && r.cache.get(r.id, buf, off)
+}
+
+func (r diskRanges) put(data []byte, off int64) {
+	if r.cache != nil {
+		r.cache.put(r.id, data, off, r.logger)
+	}
+}
+
+// remove drops the range of length bytes at off, which turned out to be
+// corrupt.
+func (r diskRanges) remove(off, length int64) {
+	if r.cache != nil {
+		_ = os.Remove(r.cache.path(r.id, off, length))
+	}
+}
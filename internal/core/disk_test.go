@@ -0,0 +1,146 @@
+package core
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// diskEntries returns the paths of the entries of the disk cache in dir.
+func diskEntries(t *testing.T, dir string) []string {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+	require.NoError(t, err)
+	return paths
+}
+
+func TestDiskCache(t *testing.T) {
+	data := testData(4 * frameSize)
+	var current atomic.Pointer[version]
+	current.Store(&version{compressed: compress(t, data), etag: `"v1"`})
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		v := current.Load()
+		w.Header().Set("ETag", v.etag)
+		http.ServeContent(w, r, "db.zst", v.modTime, bytes.NewReader(v.compressed))
+	}))
+	defer server.Close()
+	name := server.URL + "/db.zst"
+	dir := t.TempDir()
+
+	// open opens the database without a frame cache, as a new process
+	// would, scans it and reports the requests made and the reads served
+	// from the disk cache.
+	open := func(want []byte) (int64, int64) {
+		before := requests.Load()
+		file, err := Open(t.Context(), name, WithDiskCache(dir, 0), WithCacheSize(0))
+		require.NoError(t, err)
+		defer file.Close() //nolint: errcheck
+		scan(t, file, want)
+		return requests.Load() - before, file.Stats().DiskCacheHits
+	}
+
+	// The first open reads the seek table and every frame.
+	made, hits := open(data)
+	assert.EqualValues(t, 1+2+4, made)
+	assert.Zero(t, hits)
+	assert.Len(t, diskEntries(t, dir), 2+4)
+
+	// Later ones only check that the file is unchanged.
+	made, hits = open(data)
+	assert.EqualValues(t, 1, made)
+	assert.EqualValues(t, 2+4, hits)
+
+	// A replaced file is cached separately.
+	replacement := bytes.Repeat([]byte{0xab}, 4*frameSize)
+	current.Store(&version{compressed: compress(t, replacement), etag: `"v2"`})
+	made, _ = open(replacement)
+	assert.EqualValues(t, 1+2+4, made)
+	assert.Len(t, diskEntries(t, dir), 2*(2+4))
+}
+
+func TestDiskCacheWithoutValidators(t *testing.T) {
+	data := testData(4 * frameSize)
+	var current atomic.Pointer[version]
+	current.Store(&version{compressed: compress(t, data)})
+	server := replaceableServer(t, &current, false)
+	dir := t.TempDir()
+
+	file, err := Open(t.Context(), server.URL+"/db.zst", WithDiskCache(dir, 0), WithCacheSize(0))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+	scan(t, file, data)
+	assert.Empty(t, diskEntries(t, dir))
+}
+
+func TestDiskCacheCorruptEntry(t *testing.T) {
+	cache := diskCacheFor(t.TempDir(), 0)
+	data := []byte("compressed frame")
+	cache.put("db", data, 100, discardLogger)
+
+	buf := make([]byte, len(data))
+	require.True(t, cache.get("db", buf, 100))
+	assert.Equal(t, data, buf)
+
+	// Other ranges are not served.
+	assert.False(t, cache.get("db", buf, 101))
+	assert.False(t, cache.get("other", buf, 100))
+
+	path := cache.path("db", 100, int64(len(data)))
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	contents[len(contents)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, contents, 0o644))
+
+	assert.False(t, cache.get("db", buf, 100))
+	assert.NoFileExists(t, path)
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	const entrySize = diskHeaderSize + 1000
+	cache := diskCacheFor(dir, 10*entrySize)
+
+	data := make([]byte, entrySize-diskHeaderSize)
+	for off := range int64(10) {
+		cache.put("db", data, off, discardLogger)
+	}
+	assert.Len(t, diskEntries(t, dir), 10)
+
+	// Using the oldest entry saves it from eviction.
+	old := time.Now().Add(-time.Hour)
+	for off := range int64(10) {
+		path := cache.path("db", off, int64(len(data)))
+		require.NoError(t, os.Chtimes(path, old, old.Add(time.Duration(off)*time.Second)))
+	}
+	require.True(t, cache.get("db", make([]byte, len(data)), 0))
+
+	// Going over the budget evicts down to 90% of it, least recently used
+	// first.
+	cache.put("db", data, 10, discardLogger)
+	assert.Len(t, diskEntries(t, dir), 9)
+	for off, want := range map[int64]bool{0: true, 1: false, 2: false, 3: true, 10: true} {
+		assert.Equal(t, want, cache.get("db", make([]byte, len(data)), off), off)
+	}
+
+	// Entries left over by writers that died are removed.
+	stale := filepath.Join(dir, "00", diskTempPrefix+"stale")
+	require.NoError(t, os.MkdirAll(filepath.Dir(stale), 0o755))
+	require.NoError(t, os.WriteFile(stale, data, 0o644))
+	require.NoError(t, os.Chtimes(stale, old, old))
+	cache.mu.Lock()
+	require.NoError(t, cache.evict())
+	cache.mu.Unlock()
+	assert.NoFileExists(t, stale)
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var (
+	// ErrNotSeekable reports a source that does not end with a seek table,
+	// such as an uncompressed database or a plain Zstandard file.
+	ErrNotSeekable = errors.New("not a seekable zstd file")
+
+	// ErrCorruptSeekTable reports a seek table that cannot describe the
+	// source it ends.
+	ErrCorruptSeekTable = errors.New("corrupt seek table")
+
+	// ErrNoChecksums reports a database opened with checksum verification
+	// required whose seek table has no checksums.
+	ErrNoChecksums = errors.New("seek table has no checksums to verify")
+
+	// ErrChecksumMismatch reports a frame whose contents do not match the
+	// checksum in the seek table. It is wrapped in an ErrCorruptFrame.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrUnknownScheme reports a name whose URI scheme has no registered
+	// source.
+	ErrUnknownScheme = errors.New("no source registered for scheme")
+
+	// ErrSourceChanged reports a remote source that was replaced after the
+	// database was opened, detected from its ETag or Last-Modified time,
+	// or a local file mapped WithMmap that was truncated.
+	ErrSourceChanged = errors.New("source changed since it was opened")
+
+	// ErrInterrupted reports a source read stopped because the SQLite
+	// connection was interrupted.
+	ErrInterrupted = errors.New("interrupted")
+)
+
+// ErrRemoteStatus reports an unexpected HTTP response from a remote source.
+type ErrRemoteStatus struct {
+	URL    string
+	Code   int
+	Status string
+}
+
+func (e *ErrRemoteStatus) Error() string {
+	return fmt.Sprintf("%s: unexpected response status %q", e.URL, e.Status)
+}
+
+// ErrCorruptFrame reports a frame that could not be decompressed or did not
+// match the seek table.
+type ErrCorruptFrame struct {
+	Index int64
+	Err   error
+}
+
+func (e *ErrCorruptFrame) Error() string {
+	return fmt.Sprintf("corrupt frame %d: %v", e.Index, e.Err)
+}
+
+func (e *ErrCorruptFrame) Unwrap() error {
+	return e.Err
+}
+
+// Code is the SQLite result code that best describes an error. Each driver
+// adapter translates it to its driver's representation.
+type Code int
+
+const (
+	CodeCantOpen Code = iota + 1
+	CodeIOErrRead
+	CodeIOErrShortRead
+	CodeCorrupt
+	CodeAuth
+	CodeInterrupt
+)
+
+// OpenErrorCode returns the code for an error returned by Open.
+func OpenErrorCode(err error) Code {
+	switch {
+	case isInterrupt(err):
+		return CodeInterrupt
+	case isAuthError(err):
+		return CodeAuth
+	case errors.Is(err, ErrCorruptSeekTable):
+		return CodeCorrupt
+	default:
+		return CodeCantOpen
+	}
+}
+
+// ReadErrorCode returns the code for an error returned by File.ReadAt.
+func ReadErrorCode(err error) Code {
+	var corrupt *ErrCorruptFrame
+	switch {
+	case err == io.EOF:
+		return CodeIOErrShortRead
+	case isInterrupt(err):
+		return CodeInterrupt
+	case isAuthError(err):
+		return CodeAuth
+	case errors.As(err, &corrupt), errors.Is(err, ErrCorruptSeekTable):
+		return CodeCorrupt
+	default:
+		return CodeIOErrRead
+	}
+}
+
+// isInterrupt reports whether err was caused by an interrupted connection
+// or a canceled context. Expired deadlines are read errors.
+func isInterrupt(err error) bool {
+	return errors.Is(err, ErrInterrupted) || errors.Is(err, context.Canceled)
+}
+
+// isAuthError reports whether err was caused by a remote source refusing
+// access.
+func isAuthError(err error) bool {
+	var status *ErrRemoteStatus
+	return errors.As(err, &status) &&
+		(status.Code == http.StatusUnauthorized || status.Code == http.StatusForbidden)
+}
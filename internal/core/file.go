@@ -0,0 +1,895 @@
+// Package core implements the driver-independent part of the Zstandard VFS:
+// resolving a database name to its compressed bytes and serving
+// decompressed reads from them. The driver adapters under driver/ only
+// translate between this package and their driver's VFS interface.
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	seekable "github.com/SaveTheRbtz/zstd-seekable-format-go/pkg"
+	"github.com/SaveTheRbtz/zstd-seekable-format-go/pkg/env"
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	// seekTableFooterSize is the size of the Seek_Table_Footer that ends
+	// every seekable stream.
+	seekTableFooterSize = 9
+
+	// seekableMagicNumber identifies the Seek_Table_Footer.
+	seekableMagicNumber = 0x8F92EAB1
+
+	// maxFrameSize bounds the compressed size of a single frame, so that a
+	// corrupt seek table cannot make ReadAt allocate without limit.
+	maxFrameSize = 128 << 20
+)
+
+// Option configures how Open reads a compressed database.
+type Option func(*config)
+
+// config holds the settings collected from the Options passed to Open.
+type config struct {
+	decoder   decoderKey
+	cacheSize *int64 // nil selects the process-wide cache
+	readAhead int
+	timeout   time.Duration
+	connect   time.Duration
+	read      time.Duration
+	verify    verifyMode
+	tracer    *Tracer      // nil selects the Tracer set by SetTracer
+	logger    *slog.Logger // nil selects the Logger set by SetLogger
+	auth      *Auth        // nil selects the Auth set by RegisterAuth
+	retry     *RetryPolicy // nil selects DefaultRetryPolicy
+	reopen    bool
+	mmap      bool
+
+	// client, if set, replaces the http.Client chosen for the database.
+	// s3, if set, replaces the S3Config set by SetS3Config.
+	client *http.Client
+	s3     *S3Config
+
+	// diskDir, if set, replaces the directory of the disk cache set by
+	// SetDiskCache. diskSize is its budget, 0 for the default one.
+	diskDir  *string
+	diskSize int64
+
+	// readAheadMax, if above readAhead, enables the adaptive read-ahead
+	// window. readAheadConcurrency splits cache misses into parallel reads.
+	readAheadMax         int
+	readAheadConcurrency int
+}
+
+// verifyMode selects how frame checksums are verified.
+type verifyMode int
+
+const (
+	verifyIfPresent verifyMode = iota
+	verifyRequired
+	verifyNever
+)
+
+// WithReadAhead makes every cache miss also decompress up to frames
+// following frames, fetched from the source in the same read. It has no
+// effect when caching is disabled.
+func WithReadAhead(frames int) Option {
+	return func(c *config) {
+		c.readAhead = frames
+	}
+}
+
+// WithTimeout bounds the time spent opening the source and loading its
+// seek table, and each read from the source afterwards. Reads are only
+// interrupted if the source implements ReaderAtContext. A timeout of 0
+// means no limit.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeout = timeout
+	}
+}
+
+// WithConnectTimeout bounds the time the built-in HTTP source spends
+// establishing each connection, including while opening the database. A
+// timeout of 0 means no limit beyond the one set by WithTimeout.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.connect = timeout
+	}
+}
+
+// WithReadTimeout bounds each read from the source after the database is
+// open, replacing the timeout set by WithTimeout for those reads. Reads are
+// only interrupted if the source implements ReaderAtContext.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.read = timeout
+	}
+}
+
+// WithReopenOnChange makes a read that finds the remote source replaced
+// since the database was opened reopen it and read the new version,
+// instead of failing with ErrSourceChanged. SQLite may still hold pages of
+// the old version in its page cache, so this suits databases that are
+// republished with compatible contents, or read in short transactions. It
+// is the zstd_reopen URI parameter.
+func WithReopenOnChange(reopen bool) Option {
+	return func(c *config) {
+		c.reopen = reopen
+	}
+}
+
+// WithVerifyChecksums controls frame checksum verification. By default,
+// frames are verified when the seek table carries checksums. With verify
+// set, a database without checksums fails to open; with verify unset,
+// checksums are ignored.
+func WithVerifyChecksums(verify bool) Option {
+	return func(c *config) {
+		if verify {
+			c.verify = verifyRequired
+		} else {
+			c.verify = verifyNever
+		}
+	}
+}
+
+// File is an open Zstandard seekable compressed database. It is
+// driver-independent: each driver adapter translates its VFS file
+// interface to the methods below.
+//
+// ReadAt and ReadAtContext are safe to use concurrently.
+type File struct {
+	decoder *sharedDecoder
+	cfg     *config
+	timeout time.Duration // of each source read
+	connect time.Duration
+	probe
+
+	// window sizes the read-ahead of cache misses, which are split into
+	// readAheadConcurrency parallel source reads.
+	window               *readAheadWindow
+	readAheadConcurrency int
+
+	// sourceMu guards the version of the source being read, which
+	// changes when the File is reopened, and the caches keyed by it.
+	sourceMu   sync.RWMutex
+	source     io.ReaderAt
+	index      seekable.Decoder
+	id         string
+	disk       diskRanges
+	checksums  bool
+	size       int64
+	compressed int64
+	generation int
+
+	// interrupted, if set, reports whether the SQLite connection reading
+	// the File was interrupted.
+	interrupted atomic.Pointer[func() bool]
+
+	// cache holds decompressed frames. It is the process-wide cache unless
+	// the File was opened with WithCacheSize, in which case dbCache
+	// references the cache it shares with other Files on the same source.
+	cache   *frameCache
+	dbCache *databaseCache
+
+	// last is the most recently decompressed frame, which serves runs of
+	// page reads from the same frame without touching the shared cache.
+	mu   sync.Mutex
+	last cachedFrame
+
+	closeOnce sync.Once
+}
+
+// cachedFrame is a decompressed frame together with its index.
+type cachedFrame struct {
+	id   int64
+	data []byte
+}
+
+// Open opens the compressed database name for reading. The name is
+// resolved to its compressed bytes by the SourceFactory registered for its
+// URI scheme; names without a scheme are local file paths.
+func Open(ctx context.Context, name string, opts ...Option) (*File, error) {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	p := newProbe(name, cfg)
+	ctx = cfg.sourceContext(ctx, &p)
+	begin := time.Now()
+	fail := func(err error) (*File, error) {
+		p.logger.Debug("failed to open database", "error", err, "duration", time.Since(begin))
+		releaseMetrics(p.metrics)
+		return nil, err
+	}
+
+	decoder, err := acquireDecoder(cfg.decoder)
+	if err != nil {
+		return fail(err)
+	}
+
+	src, err := loadSource(ctx, &p, cfg, decoder)
+	if err != nil {
+		releaseDecoder(decoder)
+		return fail(err)
+	}
+
+	f := &File{
+		decoder:    decoder,
+		cfg:        cfg,
+		source:     src.source,
+		index:      src.index,
+		id:         src.disk.id,
+		disk:       src.disk,
+		checksums:  src.checksums && cfg.verify != verifyNever,
+		size:       src.index.Size(),
+		compressed: src.size,
+		window:     newReadAheadWindow(cfg.readAhead, cfg.readAheadMax),
+		timeout:    cfg.timeout,
+		connect:    cfg.connect,
+		probe:      p,
+		cache:      frames,
+		last:       cachedFrame{id: -1},
+	}
+
+	if cfg.read > 0 {
+		f.timeout = cfg.read
+	}
+	f.readAheadConcurrency = cfg.readAheadConcurrency
+
+	switch {
+	case cfg.cacheSize == nil:
+	case *cfg.cacheSize == 0:
+		f.cache = newFrameCache(0)
+	default:
+		f.dbCache = acquireDatabaseCache(f.id, *cfg.cacheSize)
+		f.cache = f.dbCache.frameCache
+	}
+
+	p.metrics.openFiles.Add(1)
+	p.logger.Debug("opened database",
+		"size", f.size,
+		"compressed_size", src.size,
+		"frames", src.index.NumFrames(),
+		"checksums", f.checksums,
+		"duration", time.Since(begin),
+	)
+	return f, nil
+}
+
+// sourceContext returns a copy of ctx carrying the settings of cfg that
+// the built-in sources read.
+func (c *config) sourceContext(ctx context.Context, p *probe) context.Context {
+	ctx = withLogger(ctx, p.logger)
+	ctx = withMetrics(ctx, p.metrics)
+	if c.connect > 0 {
+		ctx = withConnectTimeout(ctx, c.connect)
+	}
+	if c.auth != nil {
+		ctx = withAuth(ctx, c.auth)
+	}
+	if c.retry != nil {
+		ctx = withRetryPolicy(ctx, c.retry)
+	}
+	if c.client != nil {
+		ctx = withHTTPClient(ctx, c.client)
+	}
+	if c.s3 != nil {
+		ctx = withS3Config(ctx, c.s3)
+	}
+	if c.mmap {
+		ctx = withMmap(ctx)
+	}
+	return ctx
+}
+
+// loadedSource is a version of the source of a database, with its seek
+// table.
+type loadedSource struct {
+	source    io.ReaderAt
+	size      int64
+	index     seekable.Decoder
+	checksums bool
+
+	// disk holds the ranges of the source in the disk cache, and its id
+	// the identity of the source.
+	disk diskRanges
+}
+
+// loadSource opens the source of the database and loads its seek table.
+func loadSource(ctx context.Context, p *probe, cfg *config, decoder seekable.ZSTDDecoder) (*loadedSource, error) {
+	start := p.start()
+	source, size, err := openSource(ctx, p.name)
+	p.trace(ctx, start, TraceEvent{Op: TraceSourceOpen, Length: size, Frame: -1, Err: err})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only sources whose versions are told apart by a validator are kept in
+	// the disk cache, where stale ranges would outlive the process.
+	disk := diskRanges{id: sourceIdentity(p.name, source, size), logger: p.logger}
+	if v, ok := source.(validator); ok && v.validated() {
+		disk.cache = cfg.disk()
+	} else if ok && cfg.disk() != nil {
+		p.logger.Debug("not using the disk cache for a source without validators")
+	}
+
+	start = p.start()
+	index, checksums, err := loadIndex(ctx, p, source, size, decoder, disk)
+	if err == nil && cfg.verify == verifyRequired && !checksums {
+		p.close("seek table", index)
+		err = ErrNoChecksums
+	}
+	event := TraceEvent{Op: TraceSeekTableLoad, Length: size, Frame: -1, Err: err}
+	if err == nil {
+		event.Frame = index.NumFrames()
+	}
+	p.trace(ctx, start, event)
+	if err != nil {
+		p.closeSource(source)
+		return nil, err
+	}
+
+	return &loadedSource{source: source, size: size, index: index, checksums: checksums, disk: disk}, nil
+}
+
+// loadIndex reads the seek table from the end of the compressed stream and
+// reports whether its entries carry checksums.
+func loadIndex(ctx context.Context, p *probe, source io.ReaderAt, size int64, decoder seekable.ZSTDDecoder, disk diskRanges) (seekable.Decoder, bool, error) {
+	if size < seekTableFooterSize {
+		return nil, false, fmt.Errorf("%w: %d bytes is too small for a seek table", ErrNotSeekable, size)
+	}
+
+	footer := make([]byte, seekTableFooterSize)
+	if err := p.readCached(ctx, source, disk, footer, size-seekTableFooterSize, -1); err != nil {
+		return nil, false, fmt.Errorf("failed to read seek table footer: %w", err)
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekableMagicNumber {
+		return nil, false, fmt.Errorf("%w: seek table footer not found", ErrNotSeekable)
+	}
+
+	numFrames := int64(binary.LittleEndian.Uint32(footer[0:4]))
+	checksums := footer[4]&0x80 != 0
+
+	entrySize := int64(8)
+	if checksums {
+		entrySize += 4
+	}
+
+	// Skippable_Magic_Number and Frame_Size precede the entries.
+	tableSize := 8 + numFrames*entrySize + seekTableFooterSize
+	if tableSize > size {
+		return nil, false, fmt.Errorf("%w: %d frames do not fit in %d bytes", ErrCorruptSeekTable, numFrames, size)
+	}
+
+	table := make([]byte, tableSize)
+	if err := p.readCached(ctx, source, disk, table, size-tableSize, -1); err != nil {
+		return nil, false, fmt.Errorf("failed to read seek table: %w", err)
+	}
+
+	index, err := seekable.NewDecoder(table, decoder)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", ErrCorruptSeekTable, err)
+	}
+
+	return index, checksums, nil
+}
+
+// readCached fills buf from the disk cache if it holds the range at off,
+// and otherwise from source, storing the range in the disk cache.
+func (p *probe) readCached(ctx context.Context, source io.ReaderAt, disk diskRanges, buf []byte, off, frame int64) error {
+	if disk.get(buf, off) {
+		p.metrics.diskCacheHits.Add(1)
+		return nil
+	}
+	if err := p.readFull(ctx, source, buf, off, frame); err != nil {
+		return err
+	}
+	disk.put(buf, off)
+	return nil
+}
+
+// readFull fills buf from source at off, treating a short read as an
+// error. frame is the first frame read, or -1 for the seek table.
+func (p *probe) readFull(ctx context.Context, source io.ReaderAt, buf []byte, off, frame int64) error {
+	start := time.Now()
+
+	var n int
+	var err error
+	if r, ok := source.(ReaderAtContext); ok {
+		n, err = r.ReadAtContext(ctx, buf, off)
+	} else {
+		n, err = source.ReadAt(buf, off)
+	}
+
+	if n == len(buf) {
+		err = nil
+	} else if err == nil || errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	} else if cause := context.Cause(ctx); cause != nil && cause != ctx.Err() {
+		err = fmt.Errorf("%w: %w", cause, err)
+	}
+
+	p.metrics.fetchLatency.observe(time.Since(start))
+	p.metrics.sourceReads.Add(1)
+	p.metrics.bytesFetched.Add(int64(n))
+	p.trace(ctx, start, TraceEvent{Op: TraceFetch, Offset: off, Length: int64(len(buf)), Frame: frame, Err: err})
+	p.logger.Debug("read source", "offset", off, "length", len(buf), "duration", time.Since(start), "error", err)
+
+	return err
+}
+
+// ReadAt implements io.ReaderAt over the decompressed database.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	return f.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext is like ReadAt, but stops reading from the source once ctx
+// is done, if the source implements ReaderAtContext.
+func (f *File) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("offset before the start of the file: %d", off)
+	}
+
+	start := time.Now()
+	var n int
+	var err error
+	defer func() {
+		f.metrics.readLatency.observe(time.Since(start))
+		f.metrics.bytesRead.Add(int64(n))
+	}()
+
+	f.sourceMu.RLock()
+	generation := f.generation
+	n, err = f.readAt(ctx, p, off)
+	f.sourceMu.RUnlock()
+
+	if f.cfg.reopen && errors.Is(err, ErrSourceChanged) {
+		if err = f.reopen(ctx, generation); err != nil {
+			return 0, err
+		}
+		f.sourceMu.RLock()
+		n, err = f.readAt(ctx, p, off)
+		f.sourceMu.RUnlock()
+	}
+
+	return n, err
+}
+
+// readAt implements ReadAtContext. The caller holds sourceMu.
+func (f *File) readAt(ctx context.Context, p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= f.size {
+			return n, io.EOF
+		}
+
+		entry := f.index.GetIndexByDecompOffset(uint64(pos))
+		if entry == nil {
+			return n, fmt.Errorf("%w: no frame holds offset %d", ErrCorruptSeekTable, pos)
+		}
+
+		data, err := f.frame(ctx, entry)
+		if err != nil {
+			return n, err
+		}
+
+		n += copy(p[n:], data[uint64(pos)-entry.DecompOffset:])
+	}
+
+	return n, nil
+}
+
+// frame returns the decompressed contents of the frame described by
+// entry, from cache when possible. The returned slice must not be
+// modified.
+func (f *File) frame(ctx context.Context, entry *env.FrameOffsetEntry) ([]byte, error) {
+	start := f.start()
+
+	f.mu.Lock()
+	last := f.last
+	f.mu.Unlock()
+	if last.id == entry.ID {
+		f.metrics.cacheHits.Add(1)
+		f.trace(ctx, start, TraceEvent{Op: TraceCacheLookup, Frame: entry.ID, Hit: true})
+		return last.data, nil
+	}
+
+	data, ok := f.cache.get(f.key(entry.ID))
+	f.trace(ctx, start, TraceEvent{Op: TraceCacheLookup, Frame: entry.ID, Hit: ok})
+	if ok {
+		f.metrics.cacheHits.Add(1)
+	} else {
+		f.metrics.cacheMisses.Add(1)
+		var err error
+		data, err = f.fetch(ctx, entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.mu.Lock()
+	f.last = cachedFrame{id: entry.ID, data: data}
+	f.mu.Unlock()
+
+	return data, nil
+}
+
+func (f *File) key(frame int64) frameKey {
+	return frameKey{source: f.id, frame: frame}
+}
+
+// fetch reads the frame described by entry, and any read-ahead frames
+// after it, from the source, decompresses them and caches them. The frames
+// are read in one read, or split into parallel reads as set by
+// WithReadAheadConcurrency. A frame that another File is already fetching
+// from the same source is waited for instead of read again.
+func (f *File) fetch(ctx context.Context, entry *env.FrameOffsetEntry) ([]byte, error) {
+	key := f.key(entry.ID)
+	fl, started := flights.begin(key)
+	for !started {
+		data, shared, err := fl.wait(ctx)
+		if !shared {
+			if err == nil {
+				f.cache.add(key, data)
+			}
+			return data, err
+		}
+		// The File fetching the frame gave up, but this one still wants it.
+		fl, started = flights.begin(key)
+	}
+
+	// The frame may have been cached by a flight that landed after the
+	// cache missed.
+	if data, ok := f.cache.get(key); ok {
+		flights.finish(ctx, fl, data, nil)
+		return data, nil
+	}
+
+	entries := []*env.FrameOffsetEntry{entry}
+	fls := []*flight{fl}
+	if f.cache.enabled() {
+		frames := f.window.frames(entry.ID)
+		for id := entry.ID + 1; id <= entry.ID+int64(frames); id++ {
+			next := f.index.GetIndexByID(id)
+			if next == nil || f.cache.contains(f.key(id)) {
+				break
+			}
+			nextFl, ok := flights.begin(f.key(id))
+			if !ok {
+				break
+			}
+			entries = append(entries, next)
+			fls = append(fls, nextFl)
+		}
+		f.window.fetched(entries[len(entries)-1].ID)
+	}
+
+	for _, e := range entries {
+		if e.CompSize > maxFrameSize {
+			err := &ErrCorruptFrame{Index: e.ID, Err: fmt.Errorf("compressed size %d exceeds %d", e.CompSize, maxFrameSize)}
+			for _, fl := range fls {
+				flights.finish(ctx, fl, nil, err)
+			}
+			return nil, err
+		}
+	}
+
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+	if f.connect > 0 {
+		ctx = withConnectTimeout(ctx, f.connect)
+	}
+	if interrupted := f.interrupted.Load(); interrupted != nil {
+		if _, ok := f.source.(ReaderAtContext); ok {
+			var stop context.CancelFunc
+			ctx, stop = watchInterrupt(ctx, *interrupted)
+			defer stop()
+		}
+	}
+
+	runs := splitEntries(entries, f.readAheadConcurrency)
+	var wg sync.WaitGroup
+	for _, run := range runs[1:] {
+		runFls := fls[run[0].ID-entry.ID:][:len(run)]
+		wg.Go(func() {
+			// A read-ahead frame that fails is read again when needed.
+			if _, err := f.fetchRun(ctx, run, runFls); err != nil {
+				f.logger.Warn("discarded read-ahead frames", "frame", run[0].ID, "frames", len(run), "error", err)
+			}
+		})
+	}
+	first, err := f.fetchRun(ctx, runs[0], fls[:len(runs[0])])
+	wg.Wait()
+	return first, err
+}
+
+// fetchRun reads the consecutive frames described by entries from the
+// disk cache, or else from the source in one read per run of frames
+// missing from the disk cache, decompresses them and caches them,
+// finishing their flights. It returns the first frame; the others are
+// read ahead.
+func (f *File) fetchRun(ctx context.Context, entries []*env.FrameOffsetEntry, fls []*flight) ([]byte, error) {
+	start := entries[0].CompOffset
+	last := entries[len(entries)-1]
+	src := make([]byte, last.CompOffset+uint64(last.CompSize)-start)
+	compressed := func(e *env.FrameOffsetEntry) []byte {
+		off := e.CompOffset - start
+		return src[off : off+uint64(e.CompSize)]
+	}
+
+	onDisk := make([]bool, len(entries))
+	for i, e := range entries {
+		onDisk[i] = f.disk.get(compressed(e), int64(e.CompOffset))
+		if onDisk[i] {
+			f.metrics.diskCacheHits.Add(1)
+		}
+	}
+
+	for i := 0; i < len(entries); {
+		if onDisk[i] {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(entries) && !onDisk[j] {
+			j++
+		}
+
+		from, to := entries[i], entries[j-1]
+		span := src[from.CompOffset-start : to.CompOffset+uint64(to.CompSize)-start]
+		if err := f.readFull(ctx, f.source, span, int64(from.CompOffset), from.ID); err != nil {
+			err = fmt.Errorf("failed to read frame %d at %d: %w", from.ID, from.CompOffset, err)
+			for _, fl := range fls {
+				flights.finish(ctx, fl, nil, err)
+			}
+			return nil, err
+		}
+		for _, e := range entries[i:j] {
+			f.disk.put(compressed(e), int64(e.CompOffset))
+		}
+		i = j
+	}
+
+	var first []byte
+	for i, e := range entries {
+		data, err := f.decompress(ctx, e, compressed(e))
+		if err != nil {
+			f.disk.remove(int64(e.CompOffset), int64(e.CompSize))
+			for _, fl := range fls[i:] {
+				flights.finish(ctx, fl, nil, err)
+			}
+			if i == 0 {
+				return nil, err
+			}
+			// A bad read-ahead frame is reported when it is actually read.
+			f.logger.Warn("discarded read-ahead frame", "frame", e.ID, "error", err)
+			break
+		}
+		f.cache.add(f.key(e.ID), data)
+		flights.finish(ctx, fls[i], data, nil)
+		if i == 0 {
+			first = data
+		}
+	}
+
+	return first, nil
+}
+
+// decompress decodes the compressed frame src described by entry.
+func (f *File) decompress(ctx context.Context, entry *env.FrameOffsetEntry, src []byte) ([]byte, error) {
+	start := f.start()
+	data, err := f.decode(entry, src)
+	f.trace(ctx, start, TraceEvent{
+		Op:     TraceDecompress,
+		Offset: int64(entry.DecompOffset),
+		Length: int64(entry.DecompSize),
+		Frame:  entry.ID,
+		Err:    err,
+	})
+	return data, err
+}
+
+// decode decompresses src and checks the result against entry.
+func (f *File) decode(entry *env.FrameOffsetEntry, src []byte) ([]byte, error) {
+	data, err := f.decoder.DecodeAll(src, make([]byte, 0, entry.DecompSize))
+	if err != nil {
+		return nil, &ErrCorruptFrame{Index: entry.ID, Err: err}
+	}
+	f.metrics.framesDecompressed.Add(1)
+
+	if len(data) != int(entry.DecompSize) {
+		return nil, &ErrCorruptFrame{Index: entry.ID, Err: fmt.Errorf("decompressed to %d bytes, expected %d", len(data), entry.DecompSize)}
+	}
+
+	if f.checksums && uint32(xxhash.Sum64(data)) != entry.Checksum {
+		return nil, &ErrCorruptFrame{Index: entry.ID, Err: ErrChecksumMismatch}
+	}
+
+	return data, nil
+}
+
+// SetInterrupt makes reads from the source stop with ErrInterrupted once
+// interrupted reports true. Driver adapters use it to honor
+// sqlite3_interrupt, which SQLite itself only checks between steps of a
+// query. interrupted is polled while a read from a ReaderAtContext source
+// is in progress and must be safe to call from any goroutine.
+func (f *File) SetInterrupt(interrupted func() bool) {
+	f.interrupted.Store(&interrupted)
+}
+
+// interruptPollInterval is how often watchInterrupt polls.
+const interruptPollInterval = 10 * time.Millisecond
+
+// watchInterrupt returns a copy of ctx that is canceled with ErrInterrupted
+// once interrupted reports true. The returned function stops watching;
+// interrupted is not called after it returns.
+func watchInterrupt(ctx context.Context, interrupted func() bool) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	if interrupted() {
+		cancel(ErrInterrupted)
+		return ctx, func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interruptPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if ctx.Err() == nil && interrupted() {
+					cancel(ErrInterrupted)
+					return
+				}
+			}
+		}
+	}()
+
+	return ctx, func() {
+		cancel(nil)
+		<-done
+	}
+}
+
+// reopen replaces the version of the source read since generation with
+// the current one, unless another read already did.
+func (f *File) reopen(ctx context.Context, generation int) error {
+	f.sourceMu.Lock()
+	defer f.sourceMu.Unlock()
+	if f.generation != generation {
+		return nil
+	}
+
+	if f.cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.cfg.timeout)
+		defer cancel()
+	}
+	ctx = f.cfg.sourceContext(ctx, &f.probe)
+
+	src, err := loadSource(ctx, &f.probe, f.cfg, f.decoder)
+	if err != nil {
+		return fmt.Errorf("failed to reopen changed source: %w", err)
+	}
+
+	f.close("seek table", f.index)
+	f.closeSource(f.source)
+	f.source = src.source
+	f.index = src.index
+	f.id = src.disk.id
+	f.disk = src.disk
+	f.checksums = src.checksums && f.cfg.verify != verifyNever
+	f.size = src.index.Size()
+	f.compressed = src.size
+	f.generation++
+	f.window = newReadAheadWindow(f.cfg.readAhead, f.cfg.readAheadMax)
+	if f.dbCache != nil {
+		releaseDatabaseCache(f.dbCache)
+		f.dbCache = acquireDatabaseCache(f.id, *f.cfg.cacheSize)
+		f.cache = f.dbCache.frameCache
+	}
+
+	f.mu.Lock()
+	f.last = cachedFrame{id: -1}
+	f.mu.Unlock()
+
+	f.logger.Warn("reopened changed source", "size", f.size, "compressed_size", src.size, "frames", src.index.NumFrames())
+	return nil
+}
+
+// Size returns the size of the decompressed database.
+func (f *File) Size() int64 {
+	f.sourceMu.RLock()
+	defer f.sourceMu.RUnlock()
+	return f.size
+}
+
+// CompressedSize returns the size of the compressed database, including
+// its seek table.
+func (f *File) CompressedSize() int64 {
+	f.sourceMu.RLock()
+	defer f.sourceMu.RUnlock()
+	return f.compressed
+}
+
+// Checksums reports whether frames are verified against the checksums of
+// the seek table when they are decompressed.
+func (f *File) Checksums() bool {
+	f.sourceMu.RLock()
+	defer f.sourceMu.RUnlock()
+	return f.checksums
+}
+
+// Frame describes a frame of the compressed database: the range of the
+// decompressed database it holds, and where it is stored.
+type Frame struct {
+	Offset           int64
+	Size             int64
+	CompressedOffset int64
+	CompressedSize   int64
+}
+
+// Frames returns the frames of the database, in order.
+func (f *File) Frames() []Frame {
+	f.sourceMu.RLock()
+	defer f.sourceMu.RUnlock()
+
+	frames := make([]Frame, f.index.NumFrames())
+	for i := range frames {
+		entry := f.index.GetIndexByID(int64(i))
+		frames[i] = Frame{
+			Offset:           int64(entry.DecompOffset),
+			Size:             int64(entry.DecompSize),
+			CompressedOffset: int64(entry.CompOffset),
+			CompressedSize:   int64(entry.CompSize),
+		}
+	}
+	return frames
+}
+
+// Stats returns a snapshot of the statistics of the database, shared by
+// every File open on the same name.
+func (f *File) Stats() DatabaseStats {
+	return f.metrics.snapshot()
+}
+
+// Close releases the seek table, the decoder and the underlying source.
+// Closing a File more than once has no further effect.
+func (f *File) Close() error {
+	f.closeOnce.Do(func() {
+		f.sourceMu.Lock()
+		defer f.sourceMu.Unlock()
+		f.close("seek table", f.index)
+		if f.dbCache != nil {
+			releaseDatabaseCache(f.dbCache)
+		}
+		releaseDecoder(f.decoder)
+		f.closeSource(f.source)
+		f.metrics.openFiles.Add(-1)
+		releaseMetrics(f.metrics)
+	})
+	return nil
+}
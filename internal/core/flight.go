@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"sync"
+)
+
+// flight is a fetch of one frame that is in progress. Files that miss the
+// same frame of the same source while it is in flight wait for it instead
+// of fetching the frame again.
+type flight struct {
+	key  frameKey
+	done chan struct{}
+	data []byte
+	err  error
+
+	// abandoned reports that err is the failure of the File that started
+	// the flight to wait for it: its context was canceled, interrupted or
+	// timed out.
+	abandoned bool
+}
+
+// flights holds the frames being fetched by every open File, keyed by the
+// identity of their source, so that concurrent readers of a frame share
+// one source read whatever cache they use.
+var flights = flightGroup{calls: map[frameKey]*flight{}}
+
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[frameKey]*flight
+}
+
+// begin returns the flight fetching key and whether the caller started it,
+// in which case it must finish it.
+func (g *flightGroup) begin(key frameKey) (*flight, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if fl, ok := g.calls[key]; ok {
+		return fl, false
+	}
+	fl := &flight{key: key, done: make(chan struct{})}
+	g.calls[key] = fl
+	return fl, true
+}
+
+// finish records the result of fl, started by begin with the context ctx
+// of the fetch, and wakes up the Files waiting for it.
+func (g *flightGroup) finish(ctx context.Context, fl *flight, data []byte, err error) {
+	g.mu.Lock()
+	delete(g.calls, fl.key)
+	g.mu.Unlock()
+
+	fl.data, fl.err = data, err
+	fl.abandoned = err != nil && ctx.Err() != nil
+	close(fl.done)
+}
+
+// wait returns the result of fl, or the error of ctx if it is done first.
+// It reports whether the result is only the failure of the File that
+// started fl to wait for it, whatever error its source made of it, which
+// the caller should not share but retry with its own ctx.
+func (fl *flight) wait(ctx context.Context) ([]byte, bool, error) {
+	select {
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	case <-fl.done:
+	}
+	if fl.abandoned {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		return nil, true, fl.err
+	}
+	return fl.data, false, fl.err
+}
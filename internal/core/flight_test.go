@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalescedFetches(t *testing.T) {
+	data := testData(4 * frameSize)
+	compressed := compress(t, data)
+
+	// Slow responses keep every fetch in flight while the other readers
+	// miss the same frame.
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		http.ServeContent(w, r, "db.zst", time.Time{}, bytes.NewReader(compressed))
+	}))
+	defer server.Close()
+
+	const readers = 16
+	files := make([]*File, readers)
+	for i := range files {
+		file, err := Open(t.Context(), server.URL+"/db.zst", WithCacheSize(DefaultCacheSize))
+		require.NoError(t, err)
+		defer file.Close() //nolint: errcheck
+		files[i] = file
+	}
+
+	before := requests.Load()
+	var wg sync.WaitGroup
+	for _, file := range files {
+		wg.Go(func() {
+			for off := 0; off < len(data); off += frameSize {
+				buf := make([]byte, 16)
+				_, err := file.ReadAt(buf, int64(off))
+				assert.NoError(t, err)
+				assert.Equal(t, data[off:off+16], buf)
+			}
+		})
+	}
+	wg.Wait()
+
+	// Each frame is requested once, however many readers missed it.
+	assert.EqualValues(t, 4, requests.Load()-before)
+}
+
+func TestCoalescedFetchCanceled(t *testing.T) {
+	data := testData(4 * frameSize)
+	compressed := compress(t, data)
+
+	// The first read of a frame other than the first stalls until the
+	// client gives up on it.
+	stalled := make(chan struct{})
+	var reads atomic.Int64
+	seekTable := len(compressed) - (8 + 4*12 + seekTableFooterSize)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start int
+		_, _ = fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start)
+		if start > 0 && start < seekTable && reads.Add(1) == 1 {
+			close(stalled)
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "db.zst", time.Time{}, bytes.NewReader(compressed))
+	}))
+	defer server.Close()
+
+	name := server.URL + "/db.zst"
+	canceled, err := Open(t.Context(), name, WithCacheSize(0))
+	require.NoError(t, err)
+	defer canceled.Close() //nolint: errcheck
+
+	file, err := Open(t.Context(), name, WithCacheSize(0))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	ctx, cancel := context.WithCancel(t.Context())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := canceled.ReadAtContext(ctx, make([]byte, 16), 2*frameSize)
+		errc <- err
+	}()
+
+	// The second reader waits for the fetch of the first, then fetches the
+	// frame itself once the first gives up.
+	<-stalled
+	time.AfterFunc(50*time.Millisecond, cancel)
+	buf := make([]byte, 16)
+	_, err = file.ReadAt(buf, 2*frameSize)
+	require.NoError(t, err)
+	assert.Equal(t, data[2*frameSize:2*frameSize+16], buf)
+	require.ErrorIs(t, <-errc, context.Canceled)
+	assert.EqualValues(t, 2, reads.Load())
+}
+
+// stallingReader serves compressed, but stalls the first read of a frame
+// other than the first until its context is done, and then fails it with
+// an error of its own.
+type stallingReader struct {
+	compressed []byte
+	seekTable  int64
+	stalled    chan struct{}
+	reads      atomic.Int64
+}
+
+func (r *stallingReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+func (r *stallingReader) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if off > 0 && off < r.seekTable && r.reads.Add(1) == 1 {
+		close(r.stalled)
+		<-ctx.Done()
+		return 0, errors.New("read abandoned")
+	}
+	return bytes.NewReader(r.compressed).ReadAt(p, off)
+}
+
+func TestCoalescedFetchTimedOut(t *testing.T) {
+	data := testData(4 * frameSize)
+	compressed := compress(t, data)
+	reader := &stallingReader{
+		compressed: compressed,
+		seekTable:  int64(len(compressed) - (8 + 4*12 + seekTableFooterSize)),
+		stalled:    make(chan struct{}),
+	}
+	name := registerReader(t, reader, int64(len(compressed)))
+
+	timedOut, err := Open(t.Context(), name, WithCacheSize(0), WithReadTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	defer timedOut.Close() //nolint: errcheck
+
+	file, err := Open(t.Context(), name, WithCacheSize(0))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := timedOut.ReadAt(make([]byte, 16), 2*frameSize)
+		errc <- err
+	}()
+
+	// The second reader waits for the fetch of the first, which times out
+	// with an error that does not say so, then fetches the frame itself.
+	<-reader.stalled
+	buf := make([]byte, 16)
+	_, err = file.ReadAt(buf, 2*frameSize)
+	require.NoError(t, err)
+	assert.Equal(t, data[2*frameSize:2*frameSize+16], buf)
+	require.ErrorContains(t, <-errc, "read abandoned")
+	assert.EqualValues(t, 2, reader.reads.Load())
+}
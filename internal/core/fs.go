@@ -0,0 +1,153 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+type registeredFS struct {
+	fsys fs.FS
+
+	// generation distinguishes registrations under the same name, whose
+	// files may have the same name, size and modification time, so that
+	// they never share cached frames.
+	generation uint64
+}
+
+var (
+	filesystemsMu sync.RWMutex
+	filesystems   = map[string]registeredFS{}
+	fsGeneration  uint64
+)
+
+// RegisterFS makes the files of fsys available as name/path, so that a
+// compressed database embedded with //go:embed data.sqlite.zst into an
+// embed.FS registered as "assets" opens as assets/data.sqlite.zst, or as
+// file:assets/data.sqlite.zst?vfs=zstd through SQLite. Registered
+// filesystems take precedence over local files whose path starts with
+// name/. Registering fsys under a name already registered replaces the
+// previous filesystem; a nil fsys removes it.
+//
+// Files are read with their ReadAt method when they implement io.ReaderAt,
+// as those of embed.FS and os.DirFS do, and otherwise with Seek and Read
+// under a lock. Files that implement neither are read into memory when
+// opened.
+func RegisterFS(name string, fsys fs.FS) {
+	name = strings.Trim(name, "/")
+	if name == "" || strings.Contains(name, "/") {
+		panic(fmt.Sprintf("sqlitezstd: invalid RegisterFS name %q", name))
+	}
+
+	filesystemsMu.Lock()
+	defer filesystemsMu.Unlock()
+	if fsys == nil {
+		delete(filesystems, name)
+		return
+	}
+	fsGeneration++
+	filesystems[name] = registeredFS{fsys: fsys, generation: fsGeneration}
+}
+
+// lookupFS returns the registered filesystem serving the plain path name,
+// along with the path of name within it.
+func lookupFS(name string) (registeredFS, string, bool) {
+	first, rest, ok := strings.Cut(strings.TrimPrefix(name, "./"), "/")
+	if !ok {
+		return registeredFS{}, "", false
+	}
+
+	filesystemsMu.RLock()
+	defer filesystemsMu.RUnlock()
+	fsys, ok := filesystems[first]
+	return fsys, rest, ok
+}
+
+// openFS opens path from the registered filesystem fsys as the source of
+// the database name.
+func openFS(ctx context.Context, name string, fsys registeredFS, path string) (io.ReaderAt, int64, error) {
+	file, err := fsys.fsys.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	source, size, err := newFSFile(name, fsys.generation, file)
+	if err != nil {
+		if cerr := file.Close(); cerr != nil {
+			loggerFrom(ctx).Warn("failed to close source", "error", cerr)
+		}
+		return nil, 0, err
+	}
+	return source, size, nil
+}
+
+func newFSFile(name string, generation uint64, file fs.File) (*fsFile, int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.IsDir() {
+		return nil, 0, fmt.Errorf("%s is a directory", name)
+	}
+
+	f := &fsFile{
+		file: file,
+		id:   fmt.Sprintf("fs:%s#%d#%d#%d", name, generation, info.Size(), info.ModTime().UnixNano()),
+	}
+	switch r := file.(type) {
+	case io.ReaderAt:
+		f.ReaderAt = r
+	case io.ReadSeeker:
+		f.ReaderAt = &seekReaderAt{r: r}
+	default:
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, 0, err
+		}
+		f.ReaderAt = bytes.NewReader(data)
+		return f, int64(len(data)), nil
+	}
+	return f, info.Size(), nil
+}
+
+// fsFile is a source opened from a registered filesystem. Its cache
+// identity includes the registration, size and modification time of the
+// file.
+type fsFile struct {
+	io.ReaderAt
+	file fs.File
+	id   string
+}
+
+func (f *fsFile) Close() error {
+	return f.file.Close()
+}
+
+func (f *fsFile) identity() string {
+	return f.id
+}
+
+// seekReaderAt reads from an io.ReadSeeker at arbitrary offsets, one read
+// at a time.
+type seekReaderAt struct {
+	mu sync.Mutex
+	r  io.ReadSeeker
+}
+
+func (s *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s.r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
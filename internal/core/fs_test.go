@@ -0,0 +1,91 @@
+package core
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hidingFS serves the files of fsys through wrap, which hides methods
+// from them.
+type hidingFS struct {
+	fsys fs.FS
+	wrap func(fs.File) fs.File
+}
+
+func (h hidingFS) Open(name string) (fs.File, error) {
+	file, err := h.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return h.wrap(file), nil
+}
+
+// seekOnlyFile is an fs.File that implements io.Seeker but not
+// io.ReaderAt.
+type seekOnlyFile struct {
+	fs.File
+}
+
+func (f seekOnlyFile) Seek(offset int64, whence int) (int64, error) {
+	return f.File.(io.Seeker).Seek(offset, whence)
+}
+
+// readOnlyFile is an fs.File that implements neither io.Seeker nor
+// io.ReaderAt.
+type readOnlyFile struct {
+	fs.File
+}
+
+func TestRegisterFS(t *testing.T) {
+	data := testData(4 * frameSize)
+	files := fstest.MapFS{"dir/db.zst": {Data: compress(t, data)}}
+
+	for name, fsys := range map[string]fs.FS{
+		"readerat": files,
+		"seeker":   hidingFS{files, func(f fs.File) fs.File { return seekOnlyFile{f} }},
+		"reader":   hidingFS{files, func(f fs.File) fs.File { return readOnlyFile{f} }},
+	} {
+		t.Run(name, func(t *testing.T) {
+			RegisterFS("assets", fsys)
+			t.Cleanup(func() { RegisterFS("assets", nil) })
+
+			file, err := Open(t.Context(), "assets/dir/db.zst", WithCacheSize(0))
+			require.NoError(t, err)
+			defer file.Close() //nolint: errcheck
+			assert.EqualValues(t, len(data), file.Size())
+			scan(t, file, data)
+		})
+	}
+
+	_, err := Open(t.Context(), "assets/dir/db.zst")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	RegisterFS("assets", files)
+	t.Cleanup(func() { RegisterFS("assets", nil) })
+	_, err = Open(t.Context(), "assets/dir/missing.zst")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = Open(t.Context(), "assets/dir")
+	require.ErrorContains(t, err, "is a directory")
+}
+
+func TestRegisterFSReplaced(t *testing.T) {
+	first, second := testData(2*frameSize), make([]byte, 2*frameSize)
+	t.Cleanup(func() { RegisterFS("assets", nil) })
+
+	// Files of the same name, size and modification time in filesystems
+	// registered one after the other do not share cached frames.
+	read := func(data []byte) {
+		RegisterFS("assets", fstest.MapFS{"db.zst": {Data: compress(t, data)}})
+		file, err := Open(t.Context(), "assets/db.zst")
+		require.NoError(t, err)
+		defer file.Close() //nolint: errcheck
+		scan(t, file, data)
+	}
+	read(first)
+	read(second)
+}
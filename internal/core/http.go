@@ -0,0 +1,346 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errInvalidContentRange = errors.New("invalid Content-Range response")
+
+// httpSource reads a remote file with HTTP Range requests.
+type httpSource struct {
+	url     string
+	client  *http.Client
+	auth    Auth
+	retry   RetryPolicy
+	metrics *metrics
+	logger  *slog.Logger
+
+	// signer, if set, signs every request after auth is applied. The size
+	// of a signed source is read from the Content-Length of a HEAD
+	// response.
+	signer *s3Signer
+
+	// etag and lastModified identify the version of the file opened. They
+	// make every later request conditional on the file being unchanged.
+	etag         string
+	lastModified string
+
+	// length is the size of the file opened, which identifies its version
+	// when the server sends neither validator.
+	length int64
+}
+
+var (
+	_ ReaderAtContext = &httpSource{}
+	_ identifier      = &httpSource{}
+	_ validator       = &httpSource{}
+)
+
+// openHTTP is the built-in source for http:// and https:// URLs. It reads
+// with HTTP Range requests, authorized by the Auth set by WithAuth or
+// registered with RegisterAuth, and made with the http.Client chosen as
+// described by WithHTTPClient. Requests that fail transiently are retried
+// as the RetryPolicy set by WithRetryPolicy says.
+func openHTTP(ctx context.Context, name string) (io.ReaderAt, int64, error) {
+	source := &httpSource{
+		url:    name,
+		client: httpClientFrom(ctx, name),
+		auth:   authFrom(ctx, name),
+	}
+	return source.open(ctx, name)
+}
+
+// open finishes setting up the source of the database name and returns it
+// with its size.
+func (s *httpSource) open(ctx context.Context, name string) (io.ReaderAt, int64, error) {
+	s.retry = retryPolicyFrom(ctx)
+	s.metrics = metricsFrom(ctx, name)
+	s.logger = loggerFrom(ctx)
+
+	var size int64
+	err := s.retry.retry(ctx, s.metrics, s.logger, func() (err error) {
+		size, err = s.size(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get size: %w", err)
+	}
+	s.length = size
+	if !s.validated() {
+		s.logger.Warn("server sent no ETag or Last-Modified; a replacement of the same size cannot be detected")
+	}
+	return s, size, nil
+}
+
+// size requests the first byte of the file and returns the total size
+// reported in the Content-Range of the response, or for signed sources
+// the Content-Length of a HEAD response. It records the validators of the
+// file.
+func (s *httpSource) size(ctx context.Context) (int64, error) {
+	if s.signer != nil {
+		return s.head(ctx)
+	}
+
+	resp, err := s.get(ctx, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, s.statusError(resp)
+	}
+	s.etag = resp.Header.Get("ETag")
+	s.lastModified = resp.Header.Get("Last-Modified")
+
+	total, err := checkContentRange(resp, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	if total < 0 {
+		return 0, fmt.Errorf("%w: unknown size", errInvalidContentRange)
+	}
+	return total, nil
+}
+
+// checkContentRange parses the Content-Range header of resp, a 206
+// response to a request for length bytes at off, and checks that it holds
+// bytes from off on and none past those requested. It returns the size of
+// the file, or -1 if the server did not say.
+func checkContentRange(resp *http.Response, off, length int64) (int64, error) {
+	header := resp.Header.Get("Content-Range")
+	invalid := fmt.Errorf("%w: %q for bytes %d-%d", errInvalidContentRange, header, off, off+length-1)
+
+	unit, rest, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(unit, "bytes") {
+		return 0, invalid
+	}
+	byteRange, size, ok := strings.Cut(rest, "/")
+	if !ok {
+		return 0, invalid
+	}
+	firstByte, lastByte, _ := strings.Cut(byteRange, "-")
+	first, err := strconv.ParseInt(firstByte, 10, 64)
+	if err != nil {
+		return 0, invalid
+	}
+	last, err := strconv.ParseInt(lastByte, 10, 64)
+	if err != nil {
+		return 0, invalid
+	}
+	total := int64(-1)
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil || last >= total {
+			return 0, invalid
+		}
+	}
+	if first != off || last < first || last >= off+length {
+		return 0, invalid
+	}
+	return total, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (s *httpSource) ReadAt(p []byte, off int64) (int, error) {
+	return s.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext implements ReaderAtContext.
+func (s *httpSource) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	var n int
+	err := s.retry.retry(ctx, s.metrics, s.logger, func() (err error) {
+		n, err = s.readAt(ctx, p, off)
+		return err
+	})
+	return n, err
+}
+
+// readAt makes one attempt at ReadAtContext. It returns
+// io.ErrUnexpectedEOF if the response body is cut short, and io.EOF if the
+// file ends before p is filled.
+func (s *httpSource) readAt(ctx context.Context, p []byte, off int64) (int, error) {
+	resp, err := s.get(ctx, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+
+	if err := s.checkUnchanged(resp); err != nil {
+		return 0, err
+	}
+
+	// A server that ignores Range sends the whole file, which is only
+	// usable for reads at its start.
+	if resp.StatusCode != http.StatusPartialContent && (resp.StatusCode != http.StatusOK || off != 0) {
+		return 0, s.statusError(resp)
+	}
+	if resp.StatusCode == http.StatusOK {
+		s.logger.Warn("server ignored range request", "length", len(p))
+		if resp.ContentLength >= 0 && resp.ContentLength != s.length {
+			return 0, fmt.Errorf("%w: %s is now %d bytes", ErrSourceChanged, s.url, resp.ContentLength)
+		}
+	} else {
+		total, err := checkContentRange(resp, off, int64(len(p)))
+		if err != nil {
+			return 0, err
+		}
+		if total >= 0 && total != s.length {
+			return 0, fmt.Errorf("%w: %s is now %d bytes", ErrSourceChanged, s.url, total)
+		}
+	}
+
+	n, err := io.ReadFull(resp.Body, p)
+	switch {
+	case err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF):
+	case resp.ContentLength < 0 || int64(n) == resp.ContentLength:
+		err = io.EOF
+	default:
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// identity implements identifier. Frames of different versions of the
+// file are cached apart. Without validators, only versions of different
+// sizes are told apart.
+func (s *httpSource) identity() string {
+	return fmt.Sprintf("%s#%d#%s#%s", s.url, s.length, s.etag, s.lastModified)
+}
+
+// validated implements validator.
+func (s *httpSource) validated() bool {
+	return s.etag != "" || s.lastModified != ""
+}
+
+// isWeak reports whether etag is a weak entity tag, which conditional
+// range requests cannot use.
+func isWeak(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
+
+// setConditions makes req conditional on the file being the version
+// opened. A server that supports If-Match or If-Unmodified-Since refuses
+// it with 412 Precondition Failed otherwise, and one that only supports
+// If-Range sends the whole file.
+func (s *httpSource) setConditions(req *http.Request) {
+	switch {
+	case s.etag != "" && !isWeak(s.etag):
+		req.Header.Set("If-Match", s.etag)
+		req.Header.Set("If-Range", s.etag)
+	case s.lastModified != "":
+		req.Header.Set("If-Unmodified-Since", s.lastModified)
+		req.Header.Set("If-Range", s.lastModified)
+	}
+}
+
+// checkUnchanged returns ErrSourceChanged if resp shows that the file is
+// no longer the version opened.
+func (s *httpSource) checkUnchanged(resp *http.Response) error {
+	changed := resp.StatusCode == http.StatusPreconditionFailed
+	if etag := resp.Header.Get("ETag"); s.etag != "" && etag != "" {
+		// Weak comparison: a server may weaken the tag of a response.
+		changed = changed || strings.TrimPrefix(etag, "W/") != strings.TrimPrefix(s.etag, "W/")
+	} else if modified := resp.Header.Get("Last-Modified"); s.lastModified != "" && modified != "" {
+		changed = changed || modified != s.lastModified
+	}
+	if changed {
+		return fmt.Errorf("%w: %s", ErrSourceChanged, s.url)
+	}
+	return nil
+}
+
+// statusError returns the error for the unexpected status of resp,
+// carrying the delay of its Retry-After header if it has one.
+func (s *httpSource) statusError(resp *http.Response) error {
+	err := error(&ErrRemoteStatus{URL: s.url, Code: resp.StatusCode, Status: resp.Status})
+	if after := retryAfter(resp); after > 0 {
+		err = &retryAfterError{err: err, after: after}
+	}
+	return err
+}
+
+// head returns the size of the file from the Content-Length of a HEAD
+// response, and records its validators.
+func (s *httpSource) head(ctx context.Context) (int64, error) {
+	resp, err := s.send(ctx, http.MethodHead, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, s.statusError(resp)
+	}
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf("no Content-Length in HEAD response from %s", s.url)
+	}
+	s.etag = resp.Header.Get("ETag")
+	s.lastModified = resp.Header.Get("Last-Modified")
+	return resp.ContentLength, nil
+}
+
+// get requests length bytes at off.
+func (s *httpSource) get(ctx context.Context, off, length int64) (*http.Response, error) {
+	return s.send(ctx, http.MethodGet, off, length)
+}
+
+// send makes a request with method for length bytes at off, or for the
+// whole file if length is 0. A request refused with 401 Unauthorized, or
+// 403 Forbidden for signed sources, is retried once with refreshed
+// credentials, if the source has a provider of them.
+func (s *httpSource) send(ctx context.Context, method string, off, length int64) (*http.Response, error) {
+	resp, err := s.do(ctx, method, off, length, false)
+	if err != nil || !s.refreshable(resp) {
+		return resp, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	s.logger.Debug("refreshing credentials", "status", resp.Status)
+	return s.do(ctx, method, off, length, true)
+}
+
+// refreshable reports whether resp refused credentials that can be
+// refreshed.
+func (s *httpSource) refreshable(resp *http.Response) bool {
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return s.auth.Credentials != nil || s.signer != nil
+	case resp.StatusCode == http.StatusForbidden:
+		return s.signer != nil
+	}
+	return false
+}
+
+func (s *httpSource) do(ctx context.Context, method string, off, length int64, refresh bool) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+length-1))
+	}
+	s.setConditions(req)
+	if err := s.auth.authorize(ctx, req, refresh); err != nil {
+		return nil, err
+	}
+	if s.signer != nil {
+		if err := s.signer.sign(ctx, req, refresh); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.client.Do(req)
+}
@@ -0,0 +1,286 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stallingServer serves compressed, which holds 4 frames with checksums,
+// over HTTP, except that reads of frames other than the first stall until
+// the client gives up on them. It reports the number of stalled requests.
+func stallingServer(t *testing.T, compressed []byte) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+
+	var stalled atomic.Int64
+	seekTable := len(compressed) - (8 + 4*12 + seekTableFooterSize)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start int
+		_, _ = fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start)
+		if start > 0 && start < seekTable {
+			stalled.Add(1)
+			defer stalled.Add(-1)
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "db.zst", time.Time{}, bytes.NewReader(compressed))
+	}))
+	t.Cleanup(server.Close)
+	return server, &stalled
+}
+
+func TestReadAtContextCancel(t *testing.T) {
+	server, stalled := stallingServer(t, compress(t, testData(4*frameSize)))
+
+	file, err := Open(t.Context(), server.URL+"/db.zst", WithCacheSize(0))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err = file.ReadAtContext(ctx, make([]byte, 16), 2*frameSize)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, CodeInterrupt, ReadErrorCode(err))
+
+	// The server sees the request go away.
+	assert.Eventually(t, func() bool { return stalled.Load() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSetInterrupt(t *testing.T) {
+	server, _ := stallingServer(t, compress(t, testData(4*frameSize)))
+
+	file, err := Open(t.Context(), server.URL+"/db.zst", WithCacheSize(0))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	var interrupted atomic.Bool
+	file.SetInterrupt(interrupted.Load)
+	time.AfterFunc(50*time.Millisecond, func() { interrupted.Store(true) })
+
+	_, err = file.ReadAt(make([]byte, 16), 2*frameSize)
+	require.ErrorIs(t, err, ErrInterrupted)
+	assert.Equal(t, CodeInterrupt, ReadErrorCode(err))
+}
+
+func TestReadTimeout(t *testing.T) {
+	server, _ := stallingServer(t, compress(t, testData(4*frameSize)))
+
+	file, err := Open(t.Context(), server.URL+"/db.zst", WithCacheSize(0), WithReadTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	_, err = file.ReadAt(make([]byte, 16), 2*frameSize)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, CodeIOErrRead, ReadErrorCode(err))
+}
+
+func TestConnectTimeout(t *testing.T) {
+	server, _ := stallingServer(t, compress(t, testData(4*frameSize)))
+
+	// Connections cannot be established in a nanosecond.
+	_, err := Open(t.Context(), server.URL+"/db.zst", WithConnectTimeout(time.Nanosecond))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	file, err := Open(t.Context(), server.URL+"/db.zst", WithConnectTimeout(time.Minute))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
+
+// version is one version of a file served by replaceableServer.
+type version struct {
+	compressed []byte
+	etag       string
+	modTime    time.Time
+}
+
+// replaceableServer serves the current version of a file over HTTP. With
+// ignoreConditions set, it serves the file whatever the conditional
+// headers of the request.
+func replaceableServer(t *testing.T, current *atomic.Pointer[version], ignoreConditions bool) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := current.Load()
+		if ignoreConditions {
+			for _, key := range []string{"If-Match", "If-Range", "If-Unmodified-Since"} {
+				r.Header.Del(key)
+			}
+		}
+		if v.etag != "" {
+			w.Header().Set("ETag", v.etag)
+		}
+		http.ServeContent(w, r, "db.zst", v.modTime, bytes.NewReader(v.compressed))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSourceChanged(t *testing.T) {
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	original := compress(t, testData(4*frameSize))
+	replacement := compress(t, bytes.Repeat([]byte{0xab}, 8*frameSize))
+
+	for _, tc := range []struct {
+		name             string
+		before, after    version
+		ignoreConditions bool
+	}{
+		{"etag", version{original, `"v1"`, time.Time{}}, version{replacement, `"v2"`, time.Time{}}, false},
+		{"last modified", version{original, "", modTime}, version{replacement, "", modTime.Add(time.Hour)}, false},
+		{"weak etag", version{original, `W/"v1"`, modTime}, version{replacement, `W/"v2"`, modTime.Add(time.Hour)}, false},
+		{"conditions ignored", version{original, `"v1"`, time.Time{}}, version{replacement, `"v2"`, time.Time{}}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var current atomic.Pointer[version]
+			current.Store(&tc.before)
+			server := replaceableServer(t, &current, tc.ignoreConditions)
+
+			file, err := Open(t.Context(), server.URL+"/db.zst", WithCacheSize(0))
+			require.NoError(t, err)
+			defer file.Close() //nolint: errcheck
+
+			_, err = file.ReadAt(make([]byte, 16), 2*frameSize)
+			require.NoError(t, err)
+
+			current.Store(&tc.after)
+			_, err = file.ReadAt(make([]byte, 16), 3*frameSize)
+			require.ErrorIs(t, err, ErrSourceChanged)
+		})
+	}
+}
+
+func TestSourceWithoutValidators(t *testing.T) {
+	var current atomic.Pointer[version]
+	current.Store(&version{compressed: compress(t, testData(4*frameSize))})
+	server := replaceableServer(t, &current, false)
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	buf := make([]byte, 16)
+	file, err := Open(t.Context(), server.URL+"/db.zst", WithCacheSize(1<<20), WithLogger(logger))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+	_, err = file.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "server sent no ETag or Last-Modified")
+
+	// A replacement of a different size is not served the cached frames
+	// of the first version.
+	replacement := bytes.Repeat([]byte{0xab}, 8*frameSize)
+	current.Store(&version{compressed: compress(t, replacement)})
+	replaced, err := Open(t.Context(), server.URL+"/db.zst", WithCacheSize(1<<20))
+	require.NoError(t, err)
+	defer replaced.Close() //nolint: errcheck
+	_, err = replaced.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, replacement[:16], buf)
+}
+
+func TestReopenOnChange(t *testing.T) {
+	var current atomic.Pointer[version]
+	current.Store(&version{compressed: compress(t, testData(4*frameSize)), etag: `"v1"`})
+	server := replaceableServer(t, &current, false)
+
+	file, err := Open(t.Context(), server.URL+"/db.zst", WithReopenOnChange(true), WithCacheSize(1<<20))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	buf := make([]byte, 16)
+	_, err = file.ReadAt(buf, 3*frameSize)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4*frameSize, file.Size())
+
+	replacement := bytes.Repeat([]byte{0xab}, 8*frameSize)
+	current.Store(&version{compressed: compress(t, replacement), etag: `"v2"`})
+
+	// The next fetch finds the file replaced and reopens it.
+	_, err = file.ReadAt(buf, 2*frameSize)
+	require.NoError(t, err)
+	assert.Equal(t, replacement[:16], buf)
+	assert.EqualValues(t, 8*frameSize, file.Size())
+
+	// The frame of the first version cached earlier is no longer served.
+	_, err = file.ReadAt(buf, 3*frameSize)
+	require.NoError(t, err)
+	assert.Equal(t, replacement[:16], buf)
+}
+
+func TestContentRange(t *testing.T) {
+	data := testData(1024)
+	size := strconv.Itoa(len(data))
+	partial := func(contentRange string, body []byte) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Range", contentRange)
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(body)
+		}
+	}
+	whole := func(body []byte) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write(body)
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		off     int64
+		respond http.HandlerFunc
+		want    error
+	}{
+		{"exact", 16, partial("bytes 16-31/"+size, data[16:32]), nil},
+		{"unknown size", 16, partial("bytes 16-31/*", data[16:32]), nil},
+		{"other start", 16, partial("bytes 0-15/"+size, data[:16]), errInvalidContentRange},
+		{"past request", 16, partial("bytes 16-47/"+size, data[16:48]), errInvalidContentRange},
+		{"past end", 16, partial("bytes 16-31/20", data[16:32]), errInvalidContentRange},
+		{"malformed", 16, partial("bytes 16/"+size, data[16:32]), errInvalidContentRange},
+		{"other size", 16, partial("bytes 16-31/2048", data[16:32]), ErrSourceChanged},
+		{"range ignored at start", 0, whole(data), nil},
+		{"range ignored elsewhere", 16, whole(data), &ErrRemoteStatus{}},
+		{"range ignored, other size", 0, whole(data[:512]), ErrSourceChanged},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") == "bytes=0-0" {
+					http.ServeContent(w, r, "db.zst", time.Time{}, bytes.NewReader(data))
+					return
+				}
+				tc.respond(w, r)
+			}))
+			defer server.Close()
+
+			source, _, err := openHTTP(t.Context(), server.URL+"/db.zst")
+			require.NoError(t, err)
+
+			buf := make([]byte, 16)
+			_, err = source.ReadAt(buf, tc.off)
+			switch want := tc.want.(type) {
+			case nil:
+				require.NoError(t, err)
+				assert.Equal(t, data[tc.off:tc.off+16], buf)
+			case *ErrRemoteStatus:
+				require.ErrorAs(t, err, &want)
+				assert.Equal(t, http.StatusOK, want.Code)
+			default:
+				require.ErrorIs(t, err, want)
+			}
+		})
+	}
+
+	// The size is read from the response to a request for the first byte.
+	server := httptest.NewServer(partial("bytes 5-5/"+size, data[5:6]))
+	defer server.Close()
+	_, _, err := openHTTP(t.Context(), server.URL+"/db.zst")
+	require.ErrorIs(t, err, errInvalidContentRange)
+}
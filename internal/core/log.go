@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// discardLogger is the Logger used until SetLogger is called.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// defaultLogger is the Logger of Files opened without WithLogger.
+var defaultLogger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the Logger of the databases opened afterwards without
+// WithLogger, whichever driver opens them. Opens, source reads and retries
+// are logged at debug level; swallowed errors and fallbacks at warn level.
+// A nil Logger, the default, discards every record.
+func SetLogger(logger *slog.Logger) {
+	defaultLogger.Store(logger)
+}
+
+// WithLogger logs the activity on the database to logger instead of the
+// Logger set by SetLogger. A nil Logger discards every record.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		if logger == nil {
+			logger = discardLogger
+		}
+		c.logger = logger
+	}
+}
+
+// loggerOrDefault returns logger, or the Logger set by SetLogger if it is
+// nil.
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		logger = defaultLogger.Load()
+	}
+	if logger == nil {
+		logger = discardLogger
+	}
+	return logger
+}
+
+type loggerKey struct{}
+
+// withLogger returns a copy of ctx carrying logger, which the built-in
+// sources use for their own records.
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the Logger carried by ctx, or the Logger set by
+// SetLogger.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	logger, _ := ctx.Value(loggerKey{}).(*slog.Logger)
+	return loggerOrDefault(logger)
+}
+
+// RedactedName returns the database name as it is logged and keyed by
+// Stats: for a URL, without its password, query or fragment, which may
+// carry credentials such as the signature of a presigned URL. A URL
+// without a password is otherwise left as written.
+func RedactedName(name string) string {
+	scheme, _, ok := strings.Cut(name, "://")
+	if !ok {
+		return name
+	}
+	u, err := url.Parse(name)
+	if err != nil {
+		return scheme + "://REDACTED"
+	}
+	if _, ok := u.User.Password(); ok {
+		u.RawQuery, u.ForceQuery = "", false
+		u.Fragment, u.RawFragment = "", ""
+		return u.Redacted()
+	}
+	name, _, _ = strings.Cut(name, "#")
+	name, _, _ = strings.Cut(name, "?")
+	return name
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingCloser is a source whose Close fails.
+type failingCloser struct {
+	*bytes.Reader
+}
+
+func (failingCloser) Close() error {
+	return errors.New("close failed")
+}
+
+func TestLogger(t *testing.T) {
+	compressed := compress(t, testData(frameSize))
+	name := registerReader(t, failingCloser{bytes.NewReader(compressed)}, int64(len(compressed)))
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	file, err := Open(t.Context(), name, WithLogger(logger))
+	require.NoError(t, err)
+	_, err = file.ReadAt(make([]byte, 16), 0)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	out := buf.String()
+	assert.Contains(t, out, `level=DEBUG msg="opened database" db=`+name)
+	assert.Contains(t, out, `level=DEBUG msg="read source" db=`+name+` offset=0`)
+	assert.Contains(t, out, `level=WARN msg="failed to close source" db=`+name+` error="close failed"`)
+
+	buf.Reset()
+	_, err = OpenURI(t.Context(), name, map[string][]string{"zstd_cahce": {"1"}})
+	require.Error(t, err)
+	assert.Empty(t, buf.String(), "records go to the Logger set by SetLogger")
+
+	SetLogger(logger)
+	defer SetLogger(nil)
+	_, err = OpenURI(t.Context(), name, map[string][]string{"zstd_cahce": {"1"}})
+	require.Error(t, err)
+	assert.Contains(t, buf.String(), `level=DEBUG msg="failed to open database" db=`+name)
+}
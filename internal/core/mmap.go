@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/debug"
+)
+
+// WithMmap makes the built-in source read local files through a read-only
+// memory mapping instead of a pread system call per read, on platforms
+// that support it, currently Linux. Elsewhere, and if the file cannot be
+// mapped, it is read as usual. A mapped file truncated while open fails
+// reads of the missing bytes with ErrSourceChanged instead of crashing the
+// process. It is the zstd_mmap URI parameter.
+func WithMmap(mmap bool) Option {
+	return func(c *config) {
+		c.mmap = mmap
+	}
+}
+
+type mmapKey struct{}
+
+// withMmap returns a copy of ctx that makes the built-in source map local
+// files into memory.
+func withMmap(ctx context.Context) context.Context {
+	return context.WithValue(ctx, mmapKey{}, true)
+}
+
+// mmapFrom reports whether ctx asks for local files to be mapped.
+func mmapFrom(ctx context.Context) bool {
+	mmap, _ := ctx.Value(mmapKey{}).(bool)
+	return mmap
+}
+
+// mappedFile is a local source mapped into memory. Like localFile, its
+// cache identity includes the size and modification time. ReadAt must not
+// be called concurrently with Close, which File guarantees.
+type mappedFile struct {
+	name    string
+	data    []byte
+	size    int64
+	modTime int64
+}
+
+// ReadAt copies from the mapping. The pages of a file truncated after it
+// was mapped raise SIGBUS when touched, which the runtime turns into a
+// recoverable panic while SetPanicOnFault is on.
+func (m *mappedFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if m.data == nil {
+		return 0, fmt.Errorf("%s: read from closed mapping", m.name)
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if _, fault := r.(interface{ Addr() uintptr }); !fault {
+				panic(r)
+			}
+			n, err = 0, fmt.Errorf("%w: %s was truncated", ErrSourceChanged, m.name)
+		}
+	}()
+
+	n = copy(p, m.data[off:])
+	if n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (m *mappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return unmap(data)
+}
+
+func (m *mappedFile) identity() string {
+	return fmt.Sprintf("%s#%d#%d", m.name, m.size, m.modTime)
+}
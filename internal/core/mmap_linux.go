@@ -0,0 +1,23 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of file into memory, read-only.
+func mmap(file *os.File, size int64) ([]byte, error) {
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("%s is too large to map", file.Name())
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	return data, nil
+}
+
+func unmap(data []byte) error {
+	return os.NewSyscallError("munmap", syscall.Munmap(data))
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMmap(t *testing.T) {
+	data := testData(4 * frameSize)
+	path := filepath.Join(t.TempDir(), "db.zst")
+	require.NoError(t, os.WriteFile(path, compress(t, data), 0o644))
+
+	file, err := OpenURI(t.Context(), path, url.Values{"zstd_mmap": {"1"}, "zstd_cache": {"0"}})
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	require.IsType(t, &mappedFile{}, file.source)
+	scan(t, file, data)
+
+	// Truncating the file makes the mapped pages past its end fault.
+	require.NoError(t, os.Truncate(path, 0))
+	_, err = file.ReadAt(make([]byte, 16), 2*frameSize)
+	require.ErrorIs(t, err, ErrSourceChanged)
+
+	require.NoError(t, file.Close())
+	assert.Nil(t, file.source.(*mappedFile).data)
+}
+
+func TestMmapIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.zst")
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	identity := func(data []byte) string {
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+		source, _, err := openFile(withMmap(t.Context()), path)
+		require.NoError(t, err)
+		defer source.(io.Closer).Close() //nolint: errcheck
+		require.IsType(t, &mappedFile{}, source)
+		return source.(identifier).identity()
+	}
+
+	// A replacement with the same modification time but another size is
+	// another file.
+	assert.NotEqual(t, identity([]byte("original")), identity([]byte("replacement")))
+}
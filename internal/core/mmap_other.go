@@ -0,0 +1,17 @@
+//go:build !linux
+
+package core
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap is not supported on this platform; local files are read with pread.
+func mmap(*os.File, int64) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func unmap([]byte) error {
+	return nil
+}
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uriParameterPrefix marks the URI parameters that belong to this package.
+// SQLite and the drivers ignore parameters they do not know, so an unknown
+// parameter with this prefix is almost certainly a typo and is rejected.
+const uriParameterPrefix = "zstd_"
+
+// uriParameters maps each supported URI parameter to the parser of its
+// value.
+var uriParameters = map[string]func(value string) (Option, error){
+	"zstd_cache": func(value string) (Option, error) {
+		size, err := parseSize(value)
+		return WithCacheSize(size), err
+	},
+	"zstd_disk_cache": func(value string) (Option, error) {
+		return func(c *config) { c.diskDir = &value }, nil
+	},
+	"zstd_disk_cache_size": func(value string) (Option, error) {
+		size, err := parseSize(value)
+		return withDiskCacheSize(size), err
+	},
+	"zstd_mmap": func(value string) (Option, error) {
+		mmap, err := parseBool(value)
+		return WithMmap(mmap), err
+	},
+	"zstd_readahead": func(value string) (Option, error) {
+		frames, err := strconv.Atoi(value)
+		if err == nil && frames < 0 {
+			err = fmt.Errorf("negative frame count")
+		}
+		return WithReadAhead(frames), err
+	},
+	"zstd_readahead_max": func(value string) (Option, error) {
+		frames, err := strconv.Atoi(value)
+		if err == nil && frames < 0 {
+			err = fmt.Errorf("negative frame count")
+		}
+		return WithAdaptiveReadAhead(frames), err
+	},
+	"zstd_readahead_concurrency": func(value string) (Option, error) {
+		n, err := strconv.Atoi(value)
+		if err == nil && n < 1 {
+			err = fmt.Errorf("concurrency below 1")
+		}
+		return WithReadAheadConcurrency(n), err
+	},
+	"zstd_s3_endpoint": func(value string) (Option, error) {
+		return withS3(func(cfg *S3Config) { cfg.Endpoint = value }), nil
+	},
+	"zstd_s3_path_style": func(value string) (Option, error) {
+		pathStyle, err := parseBool(value)
+		return withS3(func(cfg *S3Config) { cfg.PathStyle = pathStyle }), err
+	},
+	"zstd_s3_region": func(value string) (Option, error) {
+		return withS3(func(cfg *S3Config) { cfg.Region = value }), nil
+	},
+	"zstd_timeout": func(value string) (Option, error) {
+		timeout, err := parseDuration(value)
+		return WithTimeout(timeout), err
+	},
+	"zstd_connect_timeout": func(value string) (Option, error) {
+		timeout, err := parseDuration(value)
+		return WithConnectTimeout(timeout), err
+	},
+	"zstd_read_timeout": func(value string) (Option, error) {
+		timeout, err := parseDuration(value)
+		return WithReadTimeout(timeout), err
+	},
+	"zstd_reopen": func(value string) (Option, error) {
+		reopen, err := parseBool(value)
+		return WithReopenOnChange(reopen), err
+	},
+	"zstd_retries": func(value string) (Option, error) {
+		retries, err := strconv.Atoi(value)
+		if err == nil && retries < 0 {
+			err = fmt.Errorf("negative retry count")
+		}
+		return withRetries(retries), err
+	},
+	"zstd_verify": func(value string) (Option, error) {
+		verify, err := parseBool(value)
+		return WithVerifyChecksums(verify), err
+	},
+}
+
+// ParseURIParameters returns the Options selected by the zstd_* parameters
+// of a database URI, for example
+//
+//	file:data.sqlite.zst?vfs=zstd&zstd_cache=64MiB&zstd_timeout=5s
+//
+// Parameters without the zstd_ prefix are ignored. Unknown zstd_*
+// parameters and invalid values are errors.
+func ParseURIParameters(params url.Values) ([]Option, error) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if strings.HasPrefix(key, uriParameterPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	opts := make([]Option, 0, len(keys))
+	for _, key := range keys {
+		parse, ok := uriParameters[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown URI parameter %q", key)
+		}
+
+		value := params.Get(key)
+		opt, err := parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for URI parameter %s: %w", value, key, err)
+		}
+		opts = append(opts, opt)
+	}
+
+	return opts, nil
+}
+
+// OpenURI opens the compressed database name configured by the zstd_*
+// parameters of its URI, as the driver adapters do.
+func OpenURI(ctx context.Context, name string, params url.Values) (*File, error) {
+	opts, err := ParseURIParameters(params)
+	if err != nil {
+		loggerOrDefault(nil).Debug("failed to open database", "db", name, "error", err)
+		return nil, err
+	}
+	return Open(ctx, name, opts...)
+}
+
+// sizeUnits are the suffixes accepted by parseSize.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"k":   1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gib": 1 << 30,
+}
+
+// parseSize parses a byte count such as "65536", "64MiB" or "512kb".
+func parseSize(value string) (int64, error) {
+	digits := strings.TrimRight(value, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ ")
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(value[len(digits):]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in size %q", value)
+	}
+
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	if n < 0 || n > (1<<63-1)/unit {
+		return 0, fmt.Errorf("size %q out of range", value)
+	}
+
+	return n * unit, nil
+}
+
+// parseDuration parses a non-negative duration such as "5s".
+func parseDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err == nil && d < 0 {
+		err = fmt.Errorf("negative duration")
+	}
+	return d, err
+}
+
+// parseBool parses a boolean the way sqlite3_uri_boolean does.
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "0", "false", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
+
+// URIParameterStash carries the URI parameters of a database from the
+// point where a driver's C-level xOpen can see them to the Go VFS Open
+// that only receives the database name. Opens of the same name are
+// serialized between Begin and End, so each Open sees its own parameters.
+type URIParameterStash struct {
+	mu      sync.Mutex
+	pending map[string]*pendingOpen
+}
+
+// pendingOpen holds the parameters of the open in progress for a name.
+type pendingOpen struct {
+	mu     sync.Mutex // held from Begin to End
+	refs   int
+	params url.Values
+	value  any
+}
+
+// Begin starts an open of name, waiting for any other open of the same
+// name to End first.
+func (s *URIParameterStash) Begin(name string) {
+	s.mu.Lock()
+	if s.pending == nil {
+		s.pending = make(map[string]*pendingOpen)
+	}
+	p, ok := s.pending[name]
+	if !ok {
+		p = &pendingOpen{}
+		s.pending[name] = p
+	}
+	p.refs++
+	s.mu.Unlock()
+
+	p.mu.Lock()
+	p.params = url.Values{}
+}
+
+// Add records a URI parameter of the open of name in progress.
+func (s *URIParameterStash) Add(name, key, value string) {
+	if p := s.lookup(name); p != nil {
+		p.params.Add(key, value)
+	}
+}
+
+// Get returns the URI parameters of the open of name in progress, or nil
+// if name is not being opened through Begin.
+func (s *URIParameterStash) Get(name string) url.Values {
+	if p := s.lookup(name); p != nil {
+		return p.params
+	}
+	return nil
+}
+
+// Set records a value, such as the outcome of the VFS open, for the
+// caller of Begin to retrieve with Value before End.
+func (s *URIParameterStash) Set(name string, value any) {
+	if p := s.lookup(name); p != nil {
+		p.value = value
+	}
+}
+
+// Value returns the value recorded by Set for the open of name in
+// progress.
+func (s *URIParameterStash) Value(name string) any {
+	if p := s.lookup(name); p != nil {
+		return p.value
+	}
+	return nil
+}
+
+// End finishes the open of name started by Begin.
+func (s *URIParameterStash) End(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.pending[name]
+	p.params = nil
+	p.value = nil
+	p.mu.Unlock()
+
+	p.refs--
+	if p.refs == 0 {
+		delete(s.pending, name)
+	}
+}
+
+func (s *URIParameterStash) lookup(name string) *pendingOpen {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending[name]
+}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseURIParameters(t *testing.T) {
+	params, err := url.ParseQuery("vfs=zstd&mode=ro&zstd_cache=64MiB&zstd_readahead=4&zstd_readahead_max=32&zstd_readahead_concurrency=2&zstd_timeout=5s&zstd_connect_timeout=2s&zstd_read_timeout=1s&zstd_reopen=1&zstd_retries=5&zstd_verify=1&zstd_disk_cache=/var/cache/db&zstd_disk_cache_size=10GiB&zstd_s3_region=eu-west-1&zstd_s3_endpoint=http://localhost:9000&zstd_s3_path_style=1&zstd_mmap=on")
+	require.NoError(t, err)
+
+	opts, err := ParseURIParameters(params)
+	require.NoError(t, err)
+
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	require.NotNil(t, cfg.cacheSize)
+	assert.EqualValues(t, 64<<20, *cfg.cacheSize)
+	assert.Equal(t, 4, cfg.readAhead)
+	assert.Equal(t, 32, cfg.readAheadMax)
+	assert.Equal(t, 2, cfg.readAheadConcurrency)
+	assert.Equal(t, 5*time.Second, cfg.timeout)
+	assert.Equal(t, 2*time.Second, cfg.connect)
+	assert.Equal(t, time.Second, cfg.read)
+	assert.True(t, cfg.reopen)
+	assert.True(t, cfg.mmap)
+	require.NotNil(t, cfg.retry)
+	assert.Equal(t, 5, cfg.retry.Retries)
+	assert.Equal(t, verifyRequired, cfg.verify)
+	require.NotNil(t, cfg.diskDir)
+	assert.Equal(t, "/var/cache/db", *cfg.diskDir)
+	assert.EqualValues(t, 10<<30, cfg.diskSize)
+	require.NotNil(t, cfg.s3)
+	assert.Equal(t, S3Config{Region: "eu-west-1", Endpoint: "http://localhost:9000", PathStyle: true}, *cfg.s3)
+
+	opts, err = ParseURIParameters(nil)
+	require.NoError(t, err)
+	assert.Empty(t, opts)
+}
+
+func TestParseURIParametersError(t *testing.T) {
+	for query, want := range map[string]string{
+		"zstd_cahce=64MiB":             `unknown URI parameter "zstd_cahce"`,
+		"zstd_cache=64XB":              `invalid value "64XB" for URI parameter zstd_cache`,
+		"zstd_readahead=-1":            `invalid value "-1" for URI parameter zstd_readahead`,
+		"zstd_readahead_concurrency=0": `invalid value "0" for URI parameter zstd_readahead_concurrency`,
+		"zstd_timeout=5":               `invalid value "5" for URI parameter zstd_timeout`,
+		"zstd_read_timeout=-1s":        `invalid value "-1s" for URI parameter zstd_read_timeout`,
+		"zstd_retries=-1":              `invalid value "-1" for URI parameter zstd_retries`,
+		"zstd_disk_cache_size=big":     `invalid value "big" for URI parameter zstd_disk_cache_size`,
+		"zstd_s3_path_style=maybe":     `invalid value "maybe" for URI parameter zstd_s3_path_style`,
+		"zstd_mmap=sometimes":          `invalid value "sometimes" for URI parameter zstd_mmap`,
+		"zstd_verify=always":           `invalid value "always" for URI parameter zstd_verify`,
+	} {
+		params, err := url.ParseQuery(query)
+		require.NoError(t, err)
+
+		_, err = ParseURIParameters(params)
+		assert.ErrorContains(t, err, want, query)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for value, want := range map[string]int64{
+		"0":      0,
+		"65536":  65536,
+		"512b":   512,
+		"64k":    64 << 10,
+		"64KiB":  64 << 10,
+		"64kb":   64000,
+		"64MiB":  64 << 20,
+		"64 MiB": 64 << 20,
+		"2GB":    2000000000,
+		"1g":     1 << 30,
+	} {
+		got, err := parseSize(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+
+	for _, value := range []string{"", "MiB", "-1", "1.5MiB", "1TiB", "99999999999GiB"} {
+		_, err := parseSize(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestURIParameterStash(t *testing.T) {
+	var stash URIParameterStash
+	assert.Nil(t, stash.Get("db"))
+
+	stash.Begin("db")
+	stash.Add("db", "zstd_cache", "1MiB")
+	assert.Equal(t, url.Values{"zstd_cache": {"1MiB"}}, stash.Get("db"))
+	assert.Nil(t, stash.Get("other"))
+
+	// A second open of the same name waits for the first to end.
+	began := make(chan struct{})
+	go func() {
+		stash.Begin("db")
+		close(began)
+	}()
+	select {
+	case <-began:
+		t.Fatal("second Begin did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	stash.End("db")
+	<-began
+	assert.Empty(t, stash.Get("db"))
+	stash.End("db")
+
+	assert.Nil(t, stash.Get("db"))
+	assert.Empty(t, stash.pending)
+}
+
+func TestDatabaseCache(t *testing.T) {
+	data := testData(8 * frameSize)
+	source := &countingReader{Reader: bytes.NewReader(compress(t, data))}
+	name := registerReader(t, source, source.Size())
+
+	first, err := Open(t.Context(), name, WithCacheSize(2*frameSize))
+	require.NoError(t, err)
+	second, err := Open(t.Context(), name, WithCacheSize(4*frameSize))
+	require.NoError(t, err)
+
+	assert.NotSame(t, frames, first.cache)
+	assert.Same(t, first.cache, second.cache)
+	assert.EqualValues(t, 4*frameSize, first.cache.maxSize)
+
+	_, err = first.ReadAt(make([]byte, 16), 0)
+	require.NoError(t, err)
+	reads := source.reads.Load()
+	_, err = second.ReadAt(make([]byte, 16), 0)
+	require.NoError(t, err)
+	assert.Equal(t, reads, source.reads.Load())
+
+	require.NoError(t, first.Close())
+	require.NoError(t, second.Close())
+	assert.Empty(t, databaseCaches)
+}
+
+func TestReadAhead(t *testing.T) {
+	data := testData(8 * frameSize)
+	source := &countingReader{Reader: bytes.NewReader(compress(t, data))}
+	name := registerReader(t, source, source.Size())
+
+	file, err := Open(t.Context(), name, WithCacheSize(DefaultCacheSize), WithReadAhead(3))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	// Frames 0-3 come from one read, frames 4-7 from another.
+	reads := source.reads.Load()
+	got := make([]byte, len(data))
+	for off := 0; off < len(data); off += frameSize {
+		_, err = file.ReadAt(got[off:off+frameSize], int64(off))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, data, got)
+	assert.Equal(t, int64(2), source.reads.Load()-reads)
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	data := testData(4 * frameSize)
+	compressed := compress(t, data)
+
+	// Corrupt the checksum of frame 0 in the seek table.
+	entries := len(compressed) - seekTableFooterSize - 4*12
+	compressed[entries+8] ^= 0xff
+
+	name := registerCompressed(t, compressed)
+
+	for _, tc := range []struct {
+		opts []Option
+		err  error
+	}{
+		{nil, ErrChecksumMismatch},
+		{[]Option{WithVerifyChecksums(true)}, ErrChecksumMismatch},
+		{[]Option{WithVerifyChecksums(false)}, nil},
+	} {
+		file, err := Open(t.Context(), name, append(tc.opts, WithCacheSize(0))...)
+		require.NoError(t, err)
+
+		_, err = file.ReadAt(make([]byte, 16), 0)
+		if tc.err == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, tc.err)
+		}
+		require.NoError(t, file.Close())
+	}
+}
+
+// blockingReader blocks every read until its context is done.
+type blockingReader struct{}
+
+func (blockingReader) ReadAt([]byte, int64) (int, error) {
+	panic("ReadAtContext must be used")
+}
+
+func (blockingReader) ReadAtContext(ctx context.Context, _ []byte, _ int64) (int, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func TestTimeout(t *testing.T) {
+	name := registerReader(t, blockingReader{}, 1024)
+
+	start := time.Now()
+	_, err := Open(t.Context(), name, WithTimeout(50*time.Millisecond))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"sync"
+
+	"github.com/SaveTheRbtz/zstd-seekable-format-go/pkg/env"
+)
+
+// WithAdaptiveReadAhead makes cache misses read ahead a window of frames
+// that grows while the database is read sequentially, doubling on every
+// miss of the frame after the last one fetched, up to maxFrames, and
+// halves on other misses. The window never shrinks below the frames set by
+// WithReadAhead. It is the zstd_readahead_max URI parameter.
+func WithAdaptiveReadAhead(maxFrames int) Option {
+	return func(c *config) {
+		c.readAheadMax = maxFrames
+	}
+}
+
+// WithReadAheadConcurrency splits the frames read on a cache miss into up
+// to n reads from the source that are made in parallel, each of at least
+// one frame. It is the zstd_readahead_concurrency URI parameter.
+func WithReadAheadConcurrency(n int) Option {
+	return func(c *config) {
+		c.readAheadConcurrency = n
+	}
+}
+
+// readAheadWindow sizes the read-ahead of a File from its pattern of cache
+// misses. Each SQLite connection has a File of its own, so the pattern is
+// that of one connection.
+type readAheadWindow struct {
+	min, max int
+
+	mu   sync.Mutex
+	size int
+	next int64 // the frame after the last one fetched
+}
+
+func newReadAheadWindow(minFrames, maxFrames int) *readAheadWindow {
+	return &readAheadWindow{min: minFrames, max: maxFrames, size: minFrames, next: -1}
+}
+
+// frames returns the number of frames to read ahead of frame id, which
+// missed the cache.
+func (w *readAheadWindow) frames(id int64) int {
+	if w.max <= w.min {
+		return w.min
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if id == w.next {
+		w.size = min(max(2*w.size, 1), w.max)
+	} else {
+		w.size = max(w.size/2, w.min)
+	}
+	return w.size
+}
+
+// fetched records that frames up to last were fetched.
+func (w *readAheadWindow) fetched(last int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.next = last + 1
+}
+
+// splitEntries splits the consecutive entries into up to n runs of
+// consecutive entries of similar length, each read with one source read.
+func splitEntries(entries []*env.FrameOffsetEntry, n int) [][]*env.FrameOffsetEntry {
+	n = min(max(n, 1), len(entries))
+	runs := make([][]*env.FrameOffsetEntry, 0, n)
+	for i := range n {
+		runs = append(runs, entries[i*len(entries)/n:(i+1)*len(entries)/n])
+	}
+	return runs
+}
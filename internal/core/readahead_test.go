@@ -0,0 +1,78 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAheadWindow(t *testing.T) {
+	window := newReadAheadWindow(0, 8)
+
+	// Each miss of the frame after the last one fetched doubles the
+	// window, up to its maximum.
+	next := int64(0)
+	for _, want := range []int{0, 1, 2, 4, 8, 8} {
+		frames := window.frames(next)
+		assert.Equal(t, want, frames, "frame %d", next)
+		next += int64(frames) + 1
+		window.fetched(next - 1)
+	}
+
+	// Other misses halve it.
+	assert.Equal(t, 4, window.frames(3))
+	assert.Equal(t, 2, window.frames(100))
+	assert.Equal(t, 1, window.frames(50))
+	assert.Equal(t, 0, window.frames(10))
+
+	// A fixed window never changes.
+	window = newReadAheadWindow(3, 0)
+	assert.Equal(t, 3, window.frames(0))
+	window.fetched(3)
+	assert.Equal(t, 3, window.frames(4))
+}
+
+// scan reads file sequentially, a page at a time, and checks the result
+// against data.
+func scan(t *testing.T, file *File, data []byte) {
+	t.Helper()
+
+	page := make([]byte, 1024)
+	for off := 0; off < len(data); off += len(page) {
+		_, err := file.ReadAt(page, int64(off))
+		require.NoError(t, err)
+		require.Equal(t, data[off:off+len(page)], page)
+	}
+}
+
+func TestAdaptiveReadAhead(t *testing.T) {
+	data := testData(64 * frameSize)
+	source := &countingReader{Reader: bytes.NewReader(compress(t, data))}
+	name := registerReader(t, source, source.Size())
+
+	file, err := Open(t.Context(), name, WithCacheSize(DefaultCacheSize), WithAdaptiveReadAhead(16))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	// Reads of 1, 2, 3, 5, 9, 17, 17 and the last 10 frames.
+	before := source.reads.Load()
+	scan(t, file, data)
+	assert.EqualValues(t, 8, source.reads.Load()-before)
+}
+
+func TestReadAheadConcurrency(t *testing.T) {
+	data := testData(8 * frameSize)
+	source := &countingReader{Reader: bytes.NewReader(compress(t, data))}
+	name := registerReader(t, source, source.Size())
+
+	file, err := Open(t.Context(), name, WithCacheSize(DefaultCacheSize), WithReadAhead(7), WithReadAheadConcurrency(4))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	// The first miss reads all 8 frames in 4 reads of 2.
+	before := source.reads.Load()
+	scan(t, file, data)
+	assert.EqualValues(t, 4, source.reads.Load()-before)
+}
@@ -10,8 +10,7 @@
 
 // ----------------
 
-// Package sqlitezstd provides utilities for the io.ReaderAt type.
-package sqlitezstd
+package core
 
 import (
 	"errors"
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how the built-in HTTP source retries requests that
+// fail transiently, such as a dropped connection or a 503 response. The
+// delay before the nth retry is MinBackoff doubled n-1 times, at most
+// MaxBackoff, less a random fraction of up to Jitter of it. A Retry-After
+// response header lengthens the delay, up to MaxBackoff.
+type RetryPolicy struct {
+	// Retries is the number of times a request is retried after its first
+	// attempt. 0 disables retries.
+	Retries int
+
+	// MinBackoff is the delay before the first retry. MaxBackoff, if set,
+	// caps every delay.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction, between 0 and 1, of each delay that is
+	// randomized so that clients failing together do not retry together.
+	Jitter float64
+
+	// RetryableStatus lists the response status codes that are retried.
+	RetryableStatus []int
+
+	// RetryableError reports whether a request that failed without a
+	// response, or whose response body was cut short, is retried. If nil,
+	// network errors other than certificate verification failures, and
+	// truncated bodies, are retried.
+	RetryableError func(err error) bool
+}
+
+// DefaultRetryPolicy returns the RetryPolicy of databases opened without
+// WithRetryPolicy: 3 retries, starting after 100ms and backing off to at
+// most 5s with 20% jitter, of network errors and of 408, 429, 500, 502,
+// 503 and 504 responses.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Retries:    3,
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+		Jitter:     0.2,
+		RetryableStatus: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// WithRetryPolicy makes the built-in HTTP source retry the requests for
+// the database as policy says. The number of retries is the zstd_retries
+// URI parameter.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *config) {
+		c.retry = &policy
+	}
+}
+
+// withRetries returns the Option of the zstd_retries URI parameter, which
+// changes the number of retries of the default policy.
+func withRetries(retries int) Option {
+	return func(c *config) {
+		policy := DefaultRetryPolicy()
+		if c.retry != nil {
+			policy = *c.retry
+		}
+		policy.Retries = retries
+		c.retry = &policy
+	}
+}
+
+type retryPolicyKey struct{}
+
+// withRetryPolicy returns a copy of ctx carrying policy, which the built-in
+// HTTP source uses instead of the default one.
+func withRetryPolicy(ctx context.Context, policy *RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// retryPolicyFrom returns the RetryPolicy carried by ctx, or the default
+// one.
+func retryPolicyFrom(ctx context.Context) RetryPolicy {
+	if policy, ok := ctx.Value(retryPolicyKey{}).(*RetryPolicy); ok {
+		return *policy
+	}
+	return DefaultRetryPolicy()
+}
+
+// retryAfterError is returned by an attempt whose response asked to be
+// retried after a delay.
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// retryAfter returns the delay of the Retry-After header of resp, in
+// seconds, or 0 if it has none.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// retryable reports whether the failed attempt that returned err is worth
+// retrying.
+func (p *RetryPolicy) retryable(err error) bool {
+	var status *ErrRemoteStatus
+	if errors.As(err, &status) {
+		return slices.Contains(p.RetryableStatus, status.Code)
+	}
+	if p.RetryableError != nil {
+		return p.RetryableError(err)
+	}
+	// An untrusted certificate stays untrusted.
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// backoff returns the delay before retry, counted from 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	d = p.capped(d)
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// capped returns d, at most MaxBackoff.
+func (p *RetryPolicy) capped(d time.Duration) time.Duration {
+	if p.MaxBackoff > 0 {
+		return min(d, p.MaxBackoff)
+	}
+	return d
+}
+
+// retry calls attempt until it succeeds, fails with an error that is not
+// retryable, runs out of retries, or ctx is done. It counts the retries in
+// m and logs them to logger.
+func (p *RetryPolicy) retry(ctx context.Context, m *metrics, logger *slog.Logger, attempt func() error) error {
+	for retry := 1; ; retry++ {
+		err := attempt()
+		if err == nil || retry > p.Retries || ctx.Err() != nil || !p.retryable(err) {
+			return err
+		}
+
+		delay := p.backoff(retry)
+		var after *retryAfterError
+		if errors.As(err, &after) && after.after > delay {
+			delay = p.capped(after.after)
+		}
+
+		m.retries.Add(1)
+		logger.Debug("retrying request", "error", err, "retry", retry, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
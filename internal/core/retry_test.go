@@ -0,0 +1,178 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failure injects a failure into the response to a request.
+type failure func(w http.ResponseWriter, r *http.Request)
+
+func failWith(code int) failure {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(code)
+	}
+}
+
+// dropConnection closes the connection in the middle of the response
+// headers. Without any response, the transport would retry the request
+// itself.
+func dropConnection(w http.ResponseWriter, _ *http.Request) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err == nil {
+		_, _ = conn.Write([]byte("HTTP/1.1 206 Partial Content\r\nContent-"))
+		_ = conn.Close()
+	}
+}
+
+// truncateBody sends the headers and half of the requested range, then
+// closes the connection.
+func truncateBody(compressed []byte) failure {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var start, end int
+		_, _ = fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		w.Header().Set("Content-Range", "bytes "+strconv.Itoa(start)+"-"+strconv.Itoa(end)+"/"+strconv.Itoa(len(compressed)))
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(compressed[start : start+(end-start+1)/2])
+		_ = http.NewResponseController(w).Flush()
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// flakyServer serves compressed, which holds 4 frames with checksums, over
+// HTTP, except that the nth read of frames other than the first fails with
+// failures[n]. It reports the number of requests.
+func flakyServer(t *testing.T, compressed []byte, failures ...failure) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+
+	var requests, reads atomic.Int64
+	seekTable := len(compressed) - (8 + 4*12 + seekTableFooterSize)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var start int
+		_, _ = fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start)
+		if start > 0 && start < seekTable {
+			if n := reads.Add(1) - 1; n < int64(len(failures)) {
+				failures[n](w, r)
+				return
+			}
+		}
+		http.ServeContent(w, r, "db.zst", time.Time{}, bytes.NewReader(compressed))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// testRetryPolicy is the default policy with short delays.
+func testRetryPolicy() RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	policy.MaxBackoff = 10 * time.Millisecond
+	return policy
+}
+
+func TestRetry(t *testing.T) {
+	data := testData(4 * frameSize)
+	compressed := compress(t, data)
+
+	for _, tc := range []struct {
+		name    string
+		failure failure
+	}{
+		{"service unavailable", failWith(http.StatusServiceUnavailable)},
+		{"too many requests", failWith(http.StatusTooManyRequests)},
+		{"dropped connection", dropConnection},
+		{"truncated body", truncateBody(compressed)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, _ := flakyServer(t, compressed, tc.failure, tc.failure)
+			name := server.URL + "/db.zst"
+
+			file, err := Open(t.Context(), name, WithRetryPolicy(testRetryPolicy()), WithCacheSize(0))
+			require.NoError(t, err)
+			defer file.Close() //nolint: errcheck
+
+			buf := make([]byte, 16)
+			_, err = file.ReadAt(buf, 2*frameSize)
+			require.NoError(t, err)
+			assert.Equal(t, data[2*frameSize:2*frameSize+16], buf)
+			assert.EqualValues(t, 2, Stats()[name].Retries)
+		})
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	compressed := compress(t, testData(4*frameSize))
+	unavailable := failWith(http.StatusServiceUnavailable)
+	server, requests := flakyServer(t, compressed, unavailable, unavailable, unavailable, unavailable, unavailable)
+	name := server.URL + "/db.zst"
+
+	policy := testRetryPolicy()
+	policy.Retries = 2
+	file, err := Open(t.Context(), name, WithRetryPolicy(policy), WithCacheSize(0))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	before := requests.Load()
+	_, err = file.ReadAt(make([]byte, 16), 2*frameSize)
+	var status *ErrRemoteStatus
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, http.StatusServiceUnavailable, status.Code)
+	assert.EqualValues(t, 3, requests.Load()-before)
+	assert.EqualValues(t, 2, Stats()[name].Retries)
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	compressed := compress(t, testData(4*frameSize))
+	server, requests := flakyServer(t, compressed, failWith(http.StatusNotFound))
+
+	file, err := Open(t.Context(), server.URL+"/db.zst", WithRetryPolicy(testRetryPolicy()), WithCacheSize(0))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	before := requests.Load()
+	_, err = file.ReadAt(make([]byte, 16), 2*frameSize)
+	require.Error(t, err)
+	assert.EqualValues(t, 1, requests.Load()-before)
+}
+
+func TestRetryStopsWhenCanceled(t *testing.T) {
+	compressed := compress(t, testData(4*frameSize))
+	server, _ := flakyServer(t, compressed, failWith(http.StatusServiceUnavailable))
+
+	policy := testRetryPolicy()
+	policy.MinBackoff = time.Hour
+	policy.MaxBackoff = time.Hour
+	file, err := Open(t.Context(), server.URL+"/db.zst", WithRetryPolicy(policy), WithCacheSize(0))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	_, err = file.ReadAtContext(ctx, make([]byte, 16), 2*frameSize)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for retry, want := range []time.Duration{10, 20, 40, 50, 50} {
+		assert.Equal(t, want*time.Millisecond, policy.backoff(retry+1), retry+1)
+	}
+
+	policy.Jitter = 0.5
+	for range 100 {
+		d := policy.backoff(2)
+		assert.True(t, d > 10*time.Millisecond && d <= 20*time.Millisecond, d)
+	}
+}
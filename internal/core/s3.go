@@ -0,0 +1,284 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// S3Config configures the built-in s3:// source, which reads objects
+// named s3://bucket/key from Amazon S3 or a compatible object store with
+// Range GET requests signed with AWS Signature Version 4.
+type S3Config struct {
+	// Region is the region requests are signed for. If empty, it is read
+	// from the AWS_REGION or AWS_DEFAULT_REGION environment variable, and
+	// defaults to us-east-1.
+	Region string
+
+	// Endpoint is the URL of the object store, such as
+	// http://localhost:9000 for MinIO. If empty, it is read from the
+	// AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL environment variable, and
+	// defaults to the Amazon S3 endpoint of Region.
+	Endpoint string
+
+	// PathStyle addresses objects as Endpoint/bucket/key instead of
+	// bucket.Endpoint/key, as most stores other than Amazon S3 require.
+	PathStyle bool
+
+	// Credentials supplies the keys requests are signed with. If nil, they
+	// are read from the environment by EnvS3Credentials.
+	Credentials S3CredentialsProvider
+}
+
+// S3Credentials are the keys that sign requests to an object store.
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is set for temporary credentials.
+	SessionToken string
+}
+
+// S3CredentialsProvider supplies the keys that sign requests to an object
+// store. It is asked again with refresh set when a request is refused
+// with 401 Unauthorized or 403 Forbidden, and should then return new
+// credentials instead of cached ones; the request is retried once with
+// them. S3Credentials is called concurrently.
+type S3CredentialsProvider interface {
+	S3Credentials(ctx context.Context, refresh bool) (S3Credentials, error)
+}
+
+// S3CredentialsFunc adapts a function to an S3CredentialsProvider.
+type S3CredentialsFunc func(ctx context.Context, refresh bool) (S3Credentials, error)
+
+// S3Credentials implements S3CredentialsProvider.
+func (f S3CredentialsFunc) S3Credentials(ctx context.Context, refresh bool) (S3Credentials, error) {
+	return f(ctx, refresh)
+}
+
+// errNoS3Credentials is returned by EnvS3Credentials when the environment
+// holds no keys.
+var errNoS3Credentials = errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+
+// EnvS3Credentials reads the keys from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables on
+// every request, so that rotated keys are picked up.
+var EnvS3Credentials S3CredentialsProvider = S3CredentialsFunc(func(context.Context, bool) (S3Credentials, error) {
+	creds := S3Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return S3Credentials{}, errNoS3Credentials
+	}
+	return creds, nil
+})
+
+// defaultS3Config is the S3Config set by SetS3Config.
+var defaultS3Config atomic.Pointer[S3Config]
+
+// SetS3Config sets the S3Config of the s3:// databases opened afterwards
+// without WithS3Config.
+func SetS3Config(cfg S3Config) {
+	defaultS3Config.Store(&cfg)
+}
+
+// WithS3Config configures the s3:// source of the database with cfg
+// instead of the S3Config set by SetS3Config. The zstd_s3_region,
+// zstd_s3_endpoint and zstd_s3_path_style URI parameters override its
+// fields.
+func WithS3Config(cfg S3Config) Option {
+	return func(c *config) {
+		c.s3 = &cfg
+	}
+}
+
+// withS3 returns the Option of a zstd_s3_* URI parameter, which changes
+// the S3Config of the database with set.
+func withS3(set func(cfg *S3Config)) Option {
+	return func(c *config) {
+		var cfg S3Config
+		if c.s3 != nil {
+			cfg = *c.s3
+		} else if def := defaultS3Config.Load(); def != nil {
+			cfg = *def
+		}
+		set(&cfg)
+		c.s3 = &cfg
+	}
+}
+
+type s3ConfigKey struct{}
+
+// withS3Config returns a copy of ctx carrying cfg, which the s3:// source
+// uses instead of the one set by SetS3Config.
+func withS3Config(ctx context.Context, cfg *S3Config) context.Context {
+	return context.WithValue(ctx, s3ConfigKey{}, cfg)
+}
+
+// s3ConfigFrom returns the S3Config carried by ctx, or else the one set by
+// SetS3Config, with the defaults of its empty fields applied.
+func s3ConfigFrom(ctx context.Context) S3Config {
+	var cfg S3Config
+	if c, ok := ctx.Value(s3ConfigKey{}).(*S3Config); ok {
+		cfg = *c
+	} else if c := defaultS3Config.Load(); c != nil {
+		cfg = *c
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = cmp.Or(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"), "https://s3."+cfg.Region+".amazonaws.com")
+	}
+	if cfg.Credentials == nil {
+		cfg.Credentials = EnvS3Credentials
+	}
+	return cfg
+}
+
+// openS3 is the built-in source for s3://bucket/key names. It reads the
+// object with Range GET requests to the endpoint of the S3Config set by
+// WithS3Config or SetS3Config, signed with its credentials, and gets its
+// size, ETag and Last-Modified time from a HEAD request. Requests are made
+// with the http.Client chosen for the endpoint as described by
+// WithHTTPClient, and retried as the RetryPolicy set by WithRetryPolicy
+// says.
+func openS3(ctx context.Context, name string) (io.ReaderAt, int64, error) {
+	cfg := s3ConfigFrom(ctx)
+	objectURL, err := s3ObjectURL(cfg, name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	source := &httpSource{
+		url:    objectURL,
+		client: httpClientFrom(ctx, objectURL),
+		signer: &s3Signer{region: cfg.Region, credentials: cfg.Credentials, now: time.Now},
+	}
+	return source.open(ctx, name)
+}
+
+// s3ObjectURL returns the URL of the object named s3://bucket/key at the
+// endpoint of cfg.
+func s3ObjectURL(cfg S3Config, name string) (string, error) {
+	_, path, _ := strings.Cut(name, "://")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket == "" || key == "" {
+		return "", fmt.Errorf("invalid S3 object name %q: want s3://bucket/key", name)
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return "", fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+
+	path = strings.TrimSuffix(endpoint.Path, "/")
+	if cfg.PathStyle {
+		path += "/" + s3Escape(bucket)
+	} else {
+		endpoint.Host = bucket + "." + endpoint.Host
+	}
+	path += "/" + s3Escape(key)
+
+	return endpoint.Scheme + "://" + endpoint.Host + path, nil
+}
+
+// s3Escape percent-encodes every byte of s but the unreserved characters
+// of RFC 3986 and '/', as SigV4 canonical URIs require.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := range len(s) {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// emptyPayloadHash is the SHA-256 of the empty body of GET and HEAD
+// requests.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Signer signs requests with AWS Signature Version 4.
+type s3Signer struct {
+	region      string
+	credentials S3CredentialsProvider
+	now         func() time.Time
+}
+
+// sign adds the SigV4 Authorization header to req, which has no body,
+// signing its host, its Range header and its x-amz-* headers. refresh is
+// passed on to the S3CredentialsProvider.
+func (s *s3Signer) sign(ctx context.Context, req *http.Request, refresh bool) error {
+	creds, err := s.credentials.S3Credentials(ctx, refresh)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+
+	now := s.now().UTC()
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		key = strings.ToLower(key)
+		if key == "range" || strings.HasPrefix(key, "x-amz-") {
+			headers[key] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n" + req.URL.EscapedPath() + "\n" + req.URL.RawQuery + "\n")
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonical.WriteString("\n" + signedHeaders + "\n" + emptyPayloadHash)
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical.String()))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SourceFactory opens the compressed bytes of the database name and
+// returns them as an io.ReaderAt together with their size. If the
+// io.ReaderAt also implements io.Closer, it is closed when the File is.
+type SourceFactory func(ctx context.Context, name string) (io.ReaderAt, int64, error)
+
+// ReaderAtContext is implemented by sources whose reads can be cancelled,
+// such as the built-in HTTP source. File uses it to bound reads with the
+// timeout set by WithTimeout.
+type ReaderAtContext interface {
+	ReadAtContext(ctx context.Context, p []byte, off int64) (int, error)
+}
+
+// fileScheme is the scheme used for names that do not carry one.
+const fileScheme = "file"
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = map[string]SourceFactory{
+		fileScheme: openFile,
+		"http":     openHTTP,
+		"https":    openHTTP,
+		"s3":       openS3,
+	}
+)
+
+// RegisterSource makes factory responsible for opening every name of the
+// form scheme://... It replaces any factory previously registered for
+// scheme, including the built-in "file", "http", "https" and "s3"
+// sources.
+// Names without a scheme are served by the "file" source.
+func RegisterSource(scheme string, factory SourceFactory) {
+	if factory == nil {
+		panic("sqlitezstd: RegisterSource factory is nil")
+	}
+
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources[strings.ToLower(scheme)] = factory
+}
+
+// registeredReader is a reader registered by RegisterReaderAt. Its cache
+// identity includes the registration, so that a reader registered again
+// under the same name never shares cached frames with the previous one.
+type registeredReader struct {
+	io.ReaderAt
+	size int64
+	id   string
+}
+
+func (r *registeredReader) identity() string {
+	return r.id
+}
+
+var (
+	readersMu         sync.RWMutex
+	readers           = map[string]*registeredReader{}
+	readersGeneration uint64
+)
+
+// RegisterReaderAt makes name, without a scheme, open the compressed
+// database of size bytes read from r, such as a bytes.Reader over a
+// message payload, instead of a local file. Registering r under a name
+// already registered replaces the previous reader, while databases opened
+// from it keep reading it; a nil r removes the registration. r must stay
+// readable while databases opened from it are open, and is never closed.
+// Readers whose reads should be cancelled with the query are better served
+// by a SourceFactory implementing ReaderAtContext.
+func RegisterReaderAt(name string, r io.ReaderAt, size int64) {
+	if name == "" {
+		panic("sqlitezstd: RegisterReaderAt name is empty")
+	}
+
+	readersMu.Lock()
+	defer readersMu.Unlock()
+	if r == nil {
+		delete(readers, name)
+		return
+	}
+	readersGeneration++
+	readers[name] = &registeredReader{
+		ReaderAt: r,
+		size:     size,
+		id:       fmt.Sprintf("reader:%s#%d#%d", name, readersGeneration, size),
+	}
+}
+
+// lookupReaderAt returns the reader registered for name.
+func lookupReaderAt(name string) (*registeredReader, bool) {
+	readersMu.RLock()
+	defer readersMu.RUnlock()
+	r, ok := readers[name]
+	return r, ok
+}
+
+// schemeOf returns the URI scheme of name, or fileScheme when name is a
+// plain path.
+func schemeOf(name string) string {
+	scheme, _, ok := strings.Cut(name, "://")
+	if !ok || scheme == "" || strings.ContainsAny(scheme, `/\`) {
+		return fileScheme
+	}
+	return strings.ToLower(scheme)
+}
+
+// openSource returns a ReaderAt over the compressed bytes of name along
+// with their size. Names registered by RegisterReaderAt, and then plain
+// paths within a filesystem registered by RegisterFS, are served by them.
+func openSource(ctx context.Context, name string) (io.ReaderAt, int64, error) {
+	scheme := schemeOf(name)
+	if scheme == fileScheme {
+		if reader, ok := lookupReaderAt(name); ok {
+			return reader, reader.size, nil
+		}
+		if fsys, path, ok := lookupFS(name); ok {
+			return openFS(ctx, name, fsys, path)
+		}
+	}
+
+	sourcesMu.RLock()
+	factory, ok := sources[scheme]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, 0, fmt.Errorf("%w %q", ErrUnknownScheme, scheme)
+	}
+
+	return factory(ctx, name)
+}
+
+// closeSource closes source if it is an io.Closer.
+func (p *probe) closeSource(source io.ReaderAt) {
+	if closer, ok := source.(io.Closer); ok {
+		p.close("source", closer)
+	}
+}
+
+// openFile is the built-in source for local files, which are mapped into
+// memory if the database was opened WithMmap.
+func openFile(ctx context.Context, name string) (io.ReaderAt, int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		if cerr := file.Close(); cerr != nil {
+			loggerFrom(ctx).Warn("failed to close source", "error", cerr)
+		}
+		return nil, 0, err
+	}
+
+	modTime := info.ModTime().UnixNano()
+	if mmapFrom(ctx) && info.Size() > 0 {
+		data, err := mmap(file, info.Size())
+		switch {
+		case err == nil:
+			if cerr := file.Close(); cerr != nil {
+				loggerFrom(ctx).Warn("failed to close source", "error", cerr)
+			}
+			return &mappedFile{name: name, data: data, size: info.Size(), modTime: modTime}, info.Size(), nil
+		case errors.Is(err, errors.ErrUnsupported):
+		default:
+			loggerFrom(ctx).Warn("failed to map source, reading it instead", "error", err)
+		}
+	}
+
+	return &localFile{File: file, size: info.Size(), modTime: modTime}, info.Size(), nil
+}
+
+// localFile is a local source. Its cache identity includes the size and
+// modification time, so that replacing the file invalidates its frames.
+type localFile struct {
+	*os.File
+	size    int64
+	modTime int64
+}
+
+func (f *localFile) identity() string {
+	return fmt.Sprintf("%s#%d#%d", f.Name(), f.size, f.modTime)
+}
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	seekable "github.com/SaveTheRbtz/zstd-seekable-format-go/pkg"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const frameSize = 4096
+
+// compress encodes data in the seekable format, one frame per frameSize
+// bytes.
+func compress(t testing.TB, data []byte) []byte {
+	t.Helper()
+
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer encoder.Close() //nolint: errcheck
+
+	var out bytes.Buffer
+	writer, err := seekable.NewWriter(&out, encoder)
+	require.NoError(t, err)
+
+	for off := 0; off < len(data); off += frameSize {
+		_, err = writer.Write(data[off:min(off+frameSize, len(data))])
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	return out.Bytes()
+}
+
+// testData returns n bytes that vary from frame to frame.
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i/frameSize + i%7)
+	}
+	return data
+}
+
+// testSchemes numbers the schemes registered by registerTestSource.
+var testSchemes atomic.Int64
+
+// registerTestSource registers factory under a scheme of its own, removed
+// when the test ends, and returns the name of a database it opens.
+func registerTestSource(t testing.TB, factory SourceFactory) string {
+	t.Helper()
+
+	scheme := fmt.Sprintf("test%d", testSchemes.Add(1))
+	RegisterSource(scheme, factory)
+	t.Cleanup(func() {
+		sourcesMu.Lock()
+		defer sourcesMu.Unlock()
+		delete(sources, scheme)
+	})
+	return scheme + "://db"
+}
+
+// registerReader registers a source serving r, of size bytes, as for
+// registerTestSource.
+func registerReader(t testing.TB, r io.ReaderAt, size int64) string {
+	t.Helper()
+
+	return registerTestSource(t, func(context.Context, string) (io.ReaderAt, int64, error) {
+		return r, size, nil
+	})
+}
+
+// registerCompressed registers a source serving compressed, as for
+// registerTestSource.
+func registerCompressed(t testing.TB, compressed []byte) string {
+	t.Helper()
+
+	return registerReader(t, bytes.NewReader(compressed), int64(len(compressed)))
+}
+
+func TestSchemeOf(t *testing.T) {
+	for name, want := range map[string]string{
+		"db.sqlite.zst":                  "file",
+		"/var/data/db.sqlite.zst":        "file",
+		`C:\data\db.sqlite.zst`:          "file",
+		"http://example.com/db.zst":      "http",
+		"HTTPS://example.com/db.zst":     "https",
+		"mem://reference":                "mem",
+		"dir/with://colon/db.sqlite.zst": "file",
+	} {
+		assert.Equal(t, want, schemeOf(name), name)
+	}
+}
+
+func TestRegisterSource(t *testing.T) {
+	data := testData(10 * frameSize)
+	compressed := compress(t, data)
+
+	var opened string
+	name := registerTestSource(t, func(_ context.Context, name string) (io.ReaderAt, int64, error) {
+		opened = name
+		return bytes.NewReader(compressed), int64(len(compressed)), nil
+	})
+
+	file, err := Open(t.Context(), name)
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	assert.Equal(t, name, opened)
+	assert.EqualValues(t, len(data), file.Size())
+
+	got := make([]byte, 3*frameSize)
+	_, err = file.ReadAt(got, frameSize/2)
+	require.NoError(t, err)
+	assert.Equal(t, data[frameSize/2:frameSize/2+len(got)], got)
+}
+
+func TestRegisterSourceError(t *testing.T) {
+	errBackend := errors.New("backend unavailable")
+	name := registerTestSource(t, func(context.Context, string) (io.ReaderAt, int64, error) {
+		return nil, 0, errBackend
+	})
+
+	_, err := Open(t.Context(), name)
+	assert.ErrorIs(t, err, errBackend)
+
+	_, err = Open(t.Context(), "unknown://db")
+	assert.ErrorContains(t, err, `no source registered for scheme "unknown"`)
+}
+
+func TestRegisterReaderAt(t *testing.T) {
+	data := testData(4 * frameSize)
+	t.Cleanup(func() { RegisterReaderAt("payload", nil, 0) })
+
+	// A reader registered again under the same name does not share cached
+	// frames with the previous one.
+	for _, want := range [][]byte{data, make([]byte, len(data))} {
+		compressed := compress(t, want)
+		RegisterReaderAt("payload", bytes.NewReader(compressed), int64(len(compressed)))
+
+		file, err := Open(t.Context(), "payload")
+		require.NoError(t, err)
+		assert.EqualValues(t, len(want), file.Size())
+		got := make([]byte, len(want))
+		_, err = file.ReadAt(got, 0)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+		require.NoError(t, file.Close())
+	}
+
+	RegisterReaderAt("payload", nil, 0)
+	_, err := Open(t.Context(), "payload")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestLocalFileIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.zst")
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	identity := func(data []byte) string {
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+		source, _, err := openFile(t.Context(), path)
+		require.NoError(t, err)
+		defer source.(io.Closer).Close() //nolint: errcheck
+		require.IsType(t, &localFile{}, source)
+		return source.(identifier).identity()
+	}
+
+	// A replacement with the same modification time but another size is
+	// another file.
+	assert.NotEqual(t, identity([]byte("original")), identity([]byte("replacement")))
+}
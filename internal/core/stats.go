@@ -0,0 +1,267 @@
+package core
+
+import (
+	"context"
+	"expvar"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DatabaseStats is a snapshot of the work done for one database name,
+// accumulated over every File opened on it since the process started or
+// ResetStats was called.
+type DatabaseStats struct {
+	// OpenFiles is the number of Files currently open on the database.
+	OpenFiles int64 `json:"open_files"`
+
+	// SourceReads is the number of reads issued to the source, including
+	// those of the seek table. Each is one request for remote sources.
+	SourceReads int64 `json:"source_reads"`
+
+	// Retries is the number of source reads retried after a transient
+	// failure.
+	Retries int64 `json:"retries"`
+
+	// DiskCacheHits is the number of reads served from the disk cache
+	// instead of the source.
+	DiskCacheHits int64 `json:"disk_cache_hits"`
+
+	// BytesFetched is the number of compressed bytes read from the source.
+	BytesFetched int64 `json:"bytes_fetched"`
+
+	// FramesDecompressed is the number of frames decompressed, including
+	// read-ahead frames.
+	FramesDecompressed int64 `json:"frames_decompressed"`
+
+	// BytesRead is the number of decompressed bytes returned by ReadAt.
+	BytesRead int64 `json:"bytes_read"`
+
+	// CacheHits and CacheMisses count the frame lookups served from and
+	// missing from the frame cache.
+	CacheHits   int64 `json:"cache_hits"`
+	CacheMisses int64 `json:"cache_misses"`
+
+	// ReadLatency is the distribution of ReadAt call durations.
+	ReadLatency LatencyHistogram `json:"read_latency"`
+
+	// FetchLatency is the distribution of source read durations.
+	FetchLatency LatencyHistogram `json:"fetch_latency"`
+}
+
+// CacheHitRatio returns the fraction of frame lookups served from the
+// cache, or 0 if there were none.
+func (s DatabaseStats) CacheHitRatio() float64 {
+	lookups := s.CacheHits + s.CacheMisses
+	if lookups == 0 {
+		return 0
+	}
+	return float64(s.CacheHits) / float64(lookups)
+}
+
+// LatencyHistogram is a snapshot of a distribution of durations.
+type LatencyHistogram struct {
+	// Bounds are the inclusive upper bounds of the buckets, in increasing
+	// order.
+	Bounds []time.Duration `json:"bounds"`
+
+	// Counts holds the number of durations in each bucket. It has one
+	// more element than Bounds, counting the durations above the last
+	// bound.
+	Counts []int64 `json:"counts"`
+
+	// Count and Sum are the number and total of all durations.
+	Count int64         `json:"count"`
+	Sum   time.Duration `json:"sum"`
+}
+
+// latencyBounds are the bucket bounds of every LatencyHistogram.
+var latencyBounds = [...]time.Duration{
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// histogram records durations into the buckets of latencyBounds.
+type histogram struct {
+	counts [len(latencyBounds) + 1]atomic.Int64
+	count  atomic.Int64
+	sum    atomic.Int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBounds) && d > latencyBounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *histogram) reset() {
+	for i := range h.counts {
+		h.counts[i].Store(0)
+	}
+	h.count.Store(0)
+	h.sum.Store(0)
+}
+
+func (h *histogram) snapshot() LatencyHistogram {
+	s := LatencyHistogram{
+		Bounds: slices.Clone(latencyBounds[:]),
+		Counts: make([]int64, len(h.counts)),
+		Count:  h.count.Load(),
+		Sum:    time.Duration(h.sum.Load()),
+	}
+	for i := range h.counts {
+		s.Counts[i] = h.counts[i].Load()
+	}
+	return s
+}
+
+// metrics collects the statistics of a database name. The Files open on
+// the same name share it.
+type metrics struct {
+	name string
+	refs int
+
+	openFiles          atomic.Int64
+	sourceReads        atomic.Int64
+	retries            atomic.Int64
+	diskCacheHits      atomic.Int64
+	bytesFetched       atomic.Int64
+	framesDecompressed atomic.Int64
+	bytesRead          atomic.Int64
+	cacheHits          atomic.Int64
+	cacheMisses        atomic.Int64
+	readLatency        histogram
+	fetchLatency       histogram
+}
+
+var (
+	databaseMetricsMu sync.Mutex
+	databaseMetrics   = map[string]*metrics{}
+)
+
+// acquireMetrics returns the metrics of the database name for a File
+// being opened on it, creating them on first use.
+func acquireMetrics(name string) *metrics {
+	databaseMetricsMu.Lock()
+	defer databaseMetricsMu.Unlock()
+
+	m := metricsLocked(name)
+	m.refs++
+	return m
+}
+
+// releaseMetrics gives up the reference to m of a File that was closed or
+// failed to open. The statistics are kept for its name.
+func releaseMetrics(m *metrics) {
+	databaseMetricsMu.Lock()
+	defer databaseMetricsMu.Unlock()
+	m.refs--
+}
+
+// metricsLocked returns the metrics of the database name, keyed by its
+// redacted form, creating them on first use. databaseMetricsMu must be
+// held.
+func metricsLocked(name string) *metrics {
+	key := RedactedName(name)
+	m, ok := databaseMetrics[key]
+	if !ok {
+		m = &metrics{name: key}
+		databaseMetrics[key] = m
+	}
+	return m
+}
+
+type metricsKey struct{}
+
+// withMetrics returns a copy of ctx carrying m, the metrics of the File
+// being opened, which the built-in sources record their requests in.
+func withMetrics(ctx context.Context, m *metrics) context.Context {
+	return context.WithValue(ctx, metricsKey{}, m)
+}
+
+// metricsFrom returns the metrics carried by ctx, or else those of the
+// database name.
+func metricsFrom(ctx context.Context, name string) *metrics {
+	if m, ok := ctx.Value(metricsKey{}).(*metrics); ok {
+		return m
+	}
+	databaseMetricsMu.Lock()
+	defer databaseMetricsMu.Unlock()
+	return metricsLocked(name)
+}
+
+// ResetStats zeroes the statistics of the database name, except its number
+// of open Files, and drops them from Stats if no File is open on it.
+func ResetStats(name string) {
+	databaseMetricsMu.Lock()
+	defer databaseMetricsMu.Unlock()
+
+	m, ok := databaseMetrics[RedactedName(name)]
+	if !ok {
+		return
+	}
+	if m.refs == 0 {
+		delete(databaseMetrics, m.name)
+	}
+	m.reset()
+}
+
+func (m *metrics) reset() {
+	for _, counter := range []*atomic.Int64{
+		&m.sourceReads, &m.retries, &m.diskCacheHits, &m.bytesFetched,
+		&m.framesDecompressed, &m.bytesRead, &m.cacheHits, &m.cacheMisses,
+	} {
+		counter.Store(0)
+	}
+	m.readLatency.reset()
+	m.fetchLatency.reset()
+}
+
+func (m *metrics) snapshot() DatabaseStats {
+	return DatabaseStats{
+		OpenFiles:          m.openFiles.Load(),
+		SourceReads:        m.sourceReads.Load(),
+		Retries:            m.retries.Load(),
+		DiskCacheHits:      m.diskCacheHits.Load(),
+		BytesFetched:       m.bytesFetched.Load(),
+		FramesDecompressed: m.framesDecompressed.Load(),
+		BytesRead:          m.bytesRead.Load(),
+		CacheHits:          m.cacheHits.Load(),
+		CacheMisses:        m.cacheMisses.Load(),
+		ReadLatency:        m.readLatency.snapshot(),
+		FetchLatency:       m.fetchLatency.snapshot(),
+	}
+}
+
+// Stats returns a snapshot of the statistics of every database opened
+// since the process started or ResetStats forgot it, keyed by database
+// name as RedactedName returns it.
+func Stats() map[string]DatabaseStats {
+	databaseMetricsMu.Lock()
+	defer databaseMetricsMu.Unlock()
+
+	stats := make(map[string]DatabaseStats, len(databaseMetrics))
+	for name, m := range databaseMetrics {
+		stats[name] = m.snapshot()
+	}
+	return stats
+}
+
+// PublishExpvar publishes the result of Stats as the expvar variable name,
+// which makes it available from /debug/vars. Like expvar.Publish, it
+// panics if name is already in use.
+func PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return Stats()
+	}))
+}
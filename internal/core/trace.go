@@ -0,0 +1,134 @@
+package core
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// TraceOp names an operation reported to a Tracer.
+type TraceOp string
+
+const (
+	// TraceSourceOpen is the opening of the source of a database. Length
+	// is the size of the compressed source.
+	TraceSourceOpen TraceOp = "source_open"
+
+	// TraceSeekTableLoad is the reading and parsing of the seek table.
+	// Length is the size of the compressed source and, on success, Frame
+	// is the number of frames.
+	TraceSeekTableLoad TraceOp = "seek_table_load"
+
+	// TraceFetch is one read from the source, a range request for remote
+	// sources. Offset and Length locate the compressed bytes read, and
+	// Frame is the first frame read, or -1 for seek table reads.
+	TraceFetch TraceOp = "fetch"
+
+	// TraceDecompress is the decompression of one frame. Offset and Length
+	// locate the decompressed frame in the database.
+	TraceDecompress TraceOp = "decompress"
+
+	// TraceCacheLookup is a lookup of a decompressed frame. Hit reports
+	// whether the frame was cached.
+	TraceCacheLookup TraceOp = "cache_lookup"
+)
+
+// TraceEvent describes a completed operation.
+type TraceEvent struct {
+	Op TraceOp
+
+	// Name is the database name passed to Open, the URL for remote
+	// sources.
+	Name string
+
+	Offset int64
+	Length int64
+	Frame  int64
+	Hit    bool
+
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// Tracer receives an event for every traced operation once it completes,
+// with the context of the operation, so that it can be recorded as a span
+// of the tracing system in use. Trace is called concurrently and should
+// return quickly.
+type Tracer interface {
+	Trace(ctx context.Context, event TraceEvent)
+}
+
+// defaultTracer is the Tracer of Files opened without WithTracer.
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetTracer sets the Tracer of the databases opened afterwards without
+// WithTracer, whichever driver opens them. A nil Tracer disables tracing.
+func SetTracer(t Tracer) {
+	if t == nil {
+		defaultTracer.Store(nil)
+		return
+	}
+	defaultTracer.Store(&t)
+}
+
+// WithTracer reports the operations on the database to t instead of the
+// Tracer set by SetTracer. A nil Tracer disables tracing.
+func WithTracer(t Tracer) Option {
+	return func(c *config) {
+		c.tracer = &t
+	}
+}
+
+// probe records the activity on a database in its metrics, reports it to
+// its Tracer and logs it.
+type probe struct {
+	name    string
+	metrics *metrics
+	tracer  Tracer
+	logger  *slog.Logger
+}
+
+func newProbe(name string, cfg *config) probe {
+	p := probe{
+		name:    name,
+		metrics: acquireMetrics(name),
+		logger:  loggerOrDefault(cfg.logger).With("db", RedactedName(name)),
+	}
+	switch {
+	case cfg.tracer != nil:
+		p.tracer = *cfg.tracer
+	case defaultTracer.Load() != nil:
+		p.tracer = *defaultTracer.Load()
+	}
+	return p
+}
+
+// start returns the start time of a traced operation, or the zero time if
+// tracing is disabled.
+func (p *probe) start() time.Time {
+	if p.tracer == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// trace reports event, which started at start, to the Tracer.
+func (p *probe) trace(ctx context.Context, start time.Time, event TraceEvent) {
+	if p.tracer == nil {
+		return
+	}
+	event.Name = p.name
+	event.Start = start
+	event.Duration = time.Since(start)
+	p.tracer.Trace(ctx, event)
+}
+
+// close closes c, logging the error that its caller has no way to return.
+func (p *probe) close(what string, c io.Closer) {
+	if err := c.Close(); err != nil {
+		p.logger.Warn("failed to close "+what, "error", err)
+	}
+}
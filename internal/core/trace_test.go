@@ -0,0 +1,90 @@
+package core
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingTracer keeps every event it receives.
+type recordingTracer struct {
+	mu     sync.Mutex
+	events []TraceEvent
+}
+
+func (r *recordingTracer) Trace(_ context.Context, event TraceEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordingTracer) ops() []TraceOp {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ops := make([]TraceOp, len(r.events))
+	for i, event := range r.events {
+		ops[i] = event.Op
+	}
+	return ops
+}
+
+func TestTracer(t *testing.T) {
+	data := testData(2 * frameSize)
+	compressed := compress(t, data)
+	name := registerCompressed(t, compressed)
+
+	tracer := &recordingTracer{}
+	file, err := Open(t.Context(), name, WithTracer(tracer), WithCacheSize(DefaultCacheSize))
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	_, err = file.ReadAt(make([]byte, 16), frameSize+16)
+	require.NoError(t, err)
+	_, err = file.ReadAt(make([]byte, 16), frameSize)
+	require.NoError(t, err)
+
+	assert.Equal(t, []TraceOp{
+		TraceSourceOpen,
+		TraceFetch, TraceFetch, TraceSeekTableLoad,
+		TraceCacheLookup, TraceFetch, TraceDecompress,
+		TraceCacheLookup,
+	}, tracer.ops())
+
+	events := tracer.events
+	for _, event := range events {
+		assert.Equal(t, name, event.Name)
+		assert.NoError(t, event.Err)
+		assert.False(t, event.Start.IsZero())
+	}
+	assert.EqualValues(t, len(compressed), events[0].Length)
+	assert.EqualValues(t, 2, events[3].Frame)
+	assert.False(t, events[4].Hit)
+	assert.EqualValues(t, 1, events[5].Frame)
+	assert.EqualValues(t, frameSize, events[6].Offset)
+	assert.EqualValues(t, frameSize, events[6].Length)
+	assert.EqualValues(t, 1, events[6].Frame)
+	assert.True(t, events[7].Hit)
+}
+
+func TestSetTracer(t *testing.T) {
+	name := registerTestSource(t, func(context.Context, string) (io.ReaderAt, int64, error) {
+		return nil, 0, io.ErrUnexpectedEOF
+	})
+
+	tracer := &recordingTracer{}
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	_, err := Open(t.Context(), name)
+	require.Error(t, err)
+	_, err = Open(t.Context(), name, WithTracer(nil))
+	require.Error(t, err)
+
+	require.Equal(t, []TraceOp{TraceSourceOpen}, tracer.ops())
+	assert.ErrorIs(t, tracer.events[0].Err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,21 @@
+//go:build sqlitezstd_modernc && !sqlitezstd_mattn
+
+package sqlitezstd
+
+import "github.com/paulstuart/sqlitezstd/driver/modernc"
+
+// DriverName is the database/sql driver name of the selected SQLite driver.
+const DriverName = "sqlite"
+
+// VFSName returns the name the zstd VFS is registered under. The
+// modernc.org/sqlite VFS name is generated at registration time.
+func VFSName() string {
+	return modernc.VFSName()
+}
+
+// SetAuthorizer installs auth as the authorizer of conn, a connection of
+// the selected driver such as the one (*sql.Conn).Raw passes to its
+// function. A nil auth removes the authorizer.
+func SetAuthorizer(conn any, auth Authorizer) error {
+	return modernc.SetAuthorizer(conn, auth)
+}
@@ -0,0 +1,20 @@
+//go:build !sqlitezstd_mattn && !sqlitezstd_modernc
+
+package sqlitezstd
+
+import "github.com/paulstuart/sqlitezstd/driver/ncruces"
+
+// DriverName is the database/sql driver name of the selected SQLite driver.
+const DriverName = "sqlite3"
+
+// VFSName returns the name the zstd VFS is registered under.
+func VFSName() string {
+	return "zstd"
+}
+
+// SetAuthorizer installs auth as the authorizer of conn, a connection of
+// the selected driver such as the one (*sql.Conn).Raw passes to its
+// function. A nil auth removes the authorizer.
+func SetAuthorizer(conn any, auth Authorizer) error {
+	return ncruces.SetAuthorizer(conn, auth)
+}
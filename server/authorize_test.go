@@ -0,0 +1,34 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/paulstuart/sqlitezstd"
+)
+
+// TestAuthorizeFunctions checks the functions a Handler lets queries call
+// directly, as not every driver defines load_extension for a query to be
+// refused.
+func TestAuthorizeFunctions(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      Config
+		function string
+		want     sqlitezstd.AuthorizerResult
+	}{
+		{"no list", Config{}, "upper", sqlitezstd.AuthorizerDeny},
+		{"listed", Config{Functions: []string{"Upper"}}, "upper", sqlitezstd.AuthorizerOK},
+		{"unlisted", Config{Functions: []string{"upper"}}, "lower", sqlitezstd.AuthorizerDeny},
+		{"all", Config{AllowAllFunctions: true}, "lower", sqlitezstd.AuthorizerOK},
+		{"unsafe listed", Config{Functions: []string{"load_extension"}}, "load_extension", sqlitezstd.AuthorizerDeny},
+		{"unsafe all", Config{AllowAllFunctions: true}, "LOAD_EXTENSION", sqlitezstd.AuthorizerDeny},
+		{"tokenizer", Config{AllowAllFunctions: true}, "fts3_tokenizer", sqlitezstd.AuthorizerDeny},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Handler{functions: allowList(tc.cfg.Functions), allFunctions: tc.cfg.AllowAllFunctions}
+			assert.Equal(t, tc.want, h.authorize(sqlitezstd.ActionFunction, "", tc.function, "", ""))
+		})
+	}
+}
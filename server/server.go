@@ -0,0 +1,622 @@
+// Package server serves read-only SQL queries against compressed databases
+// over HTTP, as JSON. A Handler opens each database through the sqlitezstd
+// VFS with the SQLite driver selected at build time, and answers:
+//
+//	GET  /databases                   the names of the databases, sorted
+//	GET  /databases/{database}/tables the tables and views of a database
+//	GET  /databases/{database}/stats  the VFS statistics of a database
+//	POST /databases/{database}/query  run a Query, returning a Result
+//
+// Queries are limited to reading: a SQLite authorizer installed on every
+// connection refuses anything but SELECT statements, reads of the tables
+// and calls of the functions Config allows, which are none by default. Each query returns at most
+// Config.MaxRows rows and is interrupted after Config.Timeout.
+//
+// Errors are returned as a JSON object with an "error" field, with status
+// 404 Not Found for an unknown database, 403 Forbidden for a query the
+// authorizer refused, 504 Gateway Timeout for a query that ran out of time
+// and 400 Bad Request for any other failed query.
+//
+// The Handler serves the paths above from the root; mount it elsewhere
+// with http.StripPrefix.
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/paulstuart/sqlitezstd"
+)
+
+const (
+	// DefaultMaxRows is the most rows a query returns by default.
+	DefaultMaxRows = 1000
+
+	// DefaultTimeout is the time a query may run for by default.
+	DefaultTimeout = 30 * time.Second
+
+	// maxQuerySize bounds the size of a query request body.
+	maxQuerySize = 1 << 20
+)
+
+// Config configures a Handler. The zero value of every field but
+// Databases selects its default.
+type Config struct {
+	// Databases maps the names the Handler serves databases under to the
+	// compressed databases, named as for sqlitezstd.Open: a local path, a
+	// URL or a registered name. Names may not contain a slash.
+	Databases map[string]string
+
+	// MaxRows is the most rows a query returns. The rows past it are
+	// dropped and the Result marked truncated. It defaults to
+	// DefaultMaxRows.
+	MaxRows int
+
+	// Timeout bounds the time each query may run for. It defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	// Tables lists the tables queries may read, in any database. A view is
+	// read through the tables it selects from, which must be listed too.
+	// If empty, queries may read every table.
+	Tables []string
+
+	// Functions lists the SQL functions queries may call, including
+	// aggregate functions such as count. If empty, queries may call no
+	// function unless AllowAllFunctions is set.
+	Functions []string
+
+	// AllowAllFunctions lets queries call every function, ignoring
+	// Functions. Functions that reach outside the database, such as
+	// load_extension, are refused whatever Functions and AllowAllFunctions
+	// say.
+	AllowAllFunctions bool
+}
+
+// Query is the body of a query request.
+type Query struct {
+	// SQL is the SELECT statement to run.
+	SQL string `json:"sql"`
+
+	// Params are the parameters of the statement: an array for positional
+	// parameters or an object for named ones, whose names may omit the
+	// leading ':', '@' or '$'. Values are strings, numbers, booleans or
+	// null.
+	Params any `json:"params,omitempty"`
+
+	// MaxRows lowers the row limit of the Handler for this query, if
+	// positive.
+	MaxRows int `json:"max_rows,omitempty"`
+}
+
+// Result is the response to a query request.
+type Result struct {
+	// Columns are the names of the columns of the result.
+	Columns []string `json:"columns"`
+
+	// Rows hold the values of each row, in column order. BLOBs are
+	// base64-encoded strings, and infinite floats the strings "+Inf" and
+	// "-Inf".
+	Rows [][]any `json:"rows"`
+
+	// Truncated reports that the query returned more rows than the limit.
+	Truncated bool `json:"truncated"`
+}
+
+// Table describes a table or view of a database.
+type Table struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Handler is an http.Handler answering queries against a set of compressed
+// databases. It must be closed to release them.
+type Handler struct {
+	maxRows      int
+	timeout      time.Duration
+	tables       map[string]bool
+	functions    map[string]bool
+	allFunctions bool
+	databases    map[string]*database
+	mux          *http.ServeMux
+}
+
+// database is a compressed database served by a Handler.
+type database struct {
+	// source is the name the database was opened by, which its statistics
+	// are kept under.
+	source string
+
+	// query runs queries, on connections with the authorizer of the
+	// Handler installed.
+	query *sql.DB
+
+	// schema lists tables, on a connection without an authorizer.
+	schema *sql.DB
+}
+
+// NewHandler opens the databases of cfg, checking that each can be read,
+// and returns a Handler serving them.
+func NewHandler(ctx context.Context, cfg Config) (*Handler, error) {
+	if len(cfg.Databases) == 0 {
+		return nil, errors.New("no databases to serve")
+	}
+
+	h := &Handler{
+		maxRows:      cfg.MaxRows,
+		timeout:      cfg.Timeout,
+		tables:       allowList(cfg.Tables),
+		functions:    allowList(cfg.Functions),
+		allFunctions: cfg.AllowAllFunctions,
+		databases:    make(map[string]*database, len(cfg.Databases)),
+		mux:          http.NewServeMux(),
+	}
+	if h.maxRows <= 0 {
+		h.maxRows = DefaultMaxRows
+	}
+	if h.timeout <= 0 {
+		h.timeout = DefaultTimeout
+	}
+
+	for name, source := range cfg.Databases {
+		if name == "" || strings.Contains(name, "/") {
+			_ = h.Close()
+			return nil, fmt.Errorf("invalid database name %q", name)
+		}
+		db, err := h.open(ctx, source)
+		if err != nil {
+			_ = h.Close()
+			return nil, fmt.Errorf("database %s: %w", name, err)
+		}
+		h.databases[name] = db
+	}
+
+	h.mux.HandleFunc("GET /databases", h.listDatabases)
+	h.mux.HandleFunc("GET /databases/{database}/tables", h.listTables)
+	h.mux.HandleFunc("GET /databases/{database}/stats", h.stats)
+	h.mux.HandleFunc("POST /databases/{database}/query", h.query)
+	return h, nil
+}
+
+// open opens the compressed database source with a pool of connections
+// for queries and another for listing its tables.
+func (h *Handler) open(ctx context.Context, source string) (*database, error) {
+	c, err := newConnector(sqlitezstd.DSN(source) + "&mode=ro")
+	if err != nil {
+		return nil, err
+	}
+
+	db := &database{
+		source: source,
+		query:  sql.OpenDB(&connector{Connector: c, auth: h.authorize}),
+		schema: sql.OpenDB(&connector{Connector: c}),
+	}
+	db.schema.SetMaxOpenConns(1)
+
+	var n int64
+	if err := db.schema.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_schema").Scan(&n); err != nil {
+		_ = db.close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *database) close() error {
+	return errors.Join(db.query.Close(), db.schema.Close())
+}
+
+// Close closes the databases of the Handler.
+func (h *Handler) Close() error {
+	var errs []error
+	for _, db := range h.databases {
+		errs = append(errs, db.close())
+	}
+	return errors.Join(errs...)
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// unsafeFunctions are the functions queries may never call, as they load
+// code or touch files outside the database.
+var unsafeFunctions = map[string]bool{
+	"load_extension": true,
+	"fts3_tokenizer": true,
+	"readfile":       true,
+	"writefile":      true,
+	"edit":           true,
+}
+
+// authorize allows SELECT statements that read the allowed tables and call
+// the allowed functions, and denies everything else.
+func (h *Handler) authorize(action sqlitezstd.AuthorizerAction, arg1, arg2, _, _ string) sqlitezstd.AuthorizerResult {
+	switch action {
+	case sqlitezstd.ActionSelect, sqlitezstd.ActionRecursive:
+		return sqlitezstd.AuthorizerOK
+	case sqlitezstd.ActionRead:
+		if h.tables == nil || h.tables[strings.ToLower(arg1)] {
+			return sqlitezstd.AuthorizerOK
+		}
+	case sqlitezstd.ActionFunction:
+		name := strings.ToLower(arg2)
+		if !unsafeFunctions[name] && (h.allFunctions || h.functions[name]) {
+			return sqlitezstd.AuthorizerOK
+		}
+	}
+	return sqlitezstd.AuthorizerDeny
+}
+
+func (h *Handler) listDatabases(w http.ResponseWriter, _ *http.Request) {
+	names := make([]string, 0, len(h.databases))
+	for name := range h.databases {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	writeJSON(w, http.StatusOK, names)
+}
+
+func (h *Handler) listTables(w http.ResponseWriter, r *http.Request) {
+	db, ok := h.database(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	rows, err := db.schema.QueryContext(ctx, `SELECT name, type FROM sqlite_schema
+		WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY name`)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close() //nolint: errcheck
+
+	tables := []Table{}
+	for rows.Next() {
+		var table Table
+		if err := rows.Scan(&table.Name, &table.Type); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if h.tables == nil || h.tables[strings.ToLower(table.Name)] {
+			tables = append(tables, table)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tables)
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	db, ok := h.database(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, sqlitezstd.Stats()[sqlitezstd.RedactedName(db.source)])
+}
+
+func (h *Handler) query(w http.ResponseWriter, r *http.Request) {
+	db, ok := h.database(w, r)
+	if !ok {
+		return
+	}
+
+	var q Query
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQuerySize))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&q); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid query: %w", err))
+		return
+	}
+	if strings.TrimSpace(q.SQL) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("invalid query: no sql"))
+		return
+	}
+	args, err := queryArgs(q.Params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid query: %w", err))
+		return
+	}
+	maxRows := h.maxRows
+	if q.MaxRows > 0 {
+		maxRows = min(maxRows, q.MaxRows)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	result, err := runQuery(ctx, db.query, q.SQL, args, maxRows)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, result)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, fmt.Errorf("query exceeded the %v timeout", h.timeout))
+	case errors.As(err, new(deniedError)):
+		writeError(w, http.StatusForbidden, err)
+	default:
+		writeError(w, http.StatusBadRequest, err)
+	}
+}
+
+// database returns the database named by the request path, or reports it
+// unknown.
+func (h *Handler) database(w http.ResponseWriter, r *http.Request) (*database, bool) {
+	name := r.PathValue("database")
+	db, ok := h.databases[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown database %q", name))
+	}
+	return db, ok
+}
+
+// runQuery runs query and returns up to maxRows of its rows.
+func runQuery(ctx context.Context, db *sql.DB, query string, args []any, maxRows int) (*Result, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Columns: columns, Rows: [][]any{}}
+	for rows.Next() {
+		if len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			if f, ok := value.(float64); ok && math.IsInf(f, 0) {
+				values[i] = strconv.FormatFloat(f, 'g', -1, 64)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, rows.Close()
+}
+
+// queryArgs returns the arguments of the query parameters params, decoded
+// from JSON with numbers kept as json.Number.
+func queryArgs(params any) ([]any, error) {
+	switch params := params.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		args := make([]any, len(params))
+		for i, param := range params {
+			v, err := paramValue(param)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %d: %w", i+1, err)
+			}
+			args[i] = v
+		}
+		return args, nil
+	case map[string]any:
+		args := make([]any, 0, len(params))
+		for name, param := range params {
+			v, err := paramValue(param)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %s: %w", name, err)
+			}
+			args = append(args, sql.Named(strings.TrimLeft(name, ":@$"), v))
+		}
+		return args, nil
+	default:
+		return nil, errors.New("params must be an array or an object")
+	}
+}
+
+// paramValue returns the value bound for a query parameter: integers as
+// int64, other numbers as float64.
+func paramValue(param any) (any, error) {
+	switch v := param.(type) {
+	case nil, string, bool:
+		return v, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	default:
+		return nil, fmt.Errorf("unsupported value %v: only strings, numbers, booleans and null can be bound", v)
+	}
+}
+
+// allowList returns the set of names, lower-cased as SQLite compares
+// them, or nil if there are none.
+func allowList(names []string) map[string]bool {
+	if len(names) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return set
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+// connector opens connections with temporary storage in memory, since
+// none can be written next to a read-only database, and with auth
+// installed as their authorizer if it is not nil.
+type connector struct {
+	driver.Connector
+	auth sqlitezstd.Authorizer
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("unsupported driver connection: %T", conn)
+	}
+	if _, err := execer.ExecContext(ctx, "PRAGMA temp_store = memory", nil); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if c.auth == nil {
+		return conn, nil
+	}
+
+	ac := &authConn{Conn: conn}
+	err = sqlitezstd.SetAuthorizer(conn, func(action sqlitezstd.AuthorizerAction, arg1, arg2, database, trigger string) sqlitezstd.AuthorizerResult {
+		result := c.auth(action, arg1, arg2, database, trigger)
+		if result == sqlitezstd.AuthorizerDeny {
+			ac.denied.Store(true)
+		}
+		return result
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ac, nil
+}
+
+// deniedError is the error of a statement the authorizer refused.
+type deniedError struct {
+	err error
+}
+
+func (e deniedError) Error() string {
+	return e.err.Error()
+}
+
+func (e deniedError) Unwrap() error {
+	return e.err
+}
+
+// authConn is a connection with an authorizer, which returns the errors of
+// the statements the authorizer refused as deniedError. SQLite fails most
+// with SQLITE_AUTH, but a refused function call with SQLITE_ERROR, so
+// the denials are recorded as the authorizer makes them.
+type authConn struct {
+	driver.Conn
+	denied atomic.Bool
+}
+
+// check returns err, as a deniedError if the authorizer refused the
+// statement that failed with it.
+func (c *authConn) check(err error) error {
+	if c.denied.Swap(false) && err != nil {
+		return deniedError{err}
+	}
+	return err
+}
+
+func (c *authConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	c.denied.Store(false)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err := p.PrepareContext(ctx, query)
+		return stmt, c.check(err)
+	}
+	stmt, err := c.Conn.Prepare(query)
+	return stmt, c.check(err)
+}
+
+func (c *authConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	c.denied.Store(false)
+	rows, err := q.QueryContext(ctx, query, args)
+	return rows, c.check(err)
+}
+
+func (c *authConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *authConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *authConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// newConnector returns a connector for dsn of the selected driver.
+func newConnector(dsn string) (driver.Connector, error) {
+	db, err := sql.Open(sqlitezstd.DriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	_ = db.Close()
+
+	if d, ok := drv.(driver.DriverContext); ok {
+		return d.OpenConnector(dsn)
+	}
+	return dsnConnector{drv, dsn}, nil
+}
+
+// dsnConnector is the connector of a driver that does not provide one.
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
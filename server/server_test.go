@@ -0,0 +1,232 @@
+package server_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paulstuart/sqlitezstd"
+	"github.com/paulstuart/sqlitezstd/server"
+)
+
+const rowCount = 1_000
+
+// createDatabase builds a small database with an entries table, a secret
+// table and a view, and compresses it, returning the .zst path.
+func createDatabase(t *testing.T) string {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "test.sqlite")
+	client, err := sql.Open(sqlitezstd.DriverName, "file:"+dbPath)
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	_, err = client.Exec(`CREATE TABLE entries (id INTEGER PRIMARY KEY, name TEXT, data BLOB);
+		CREATE TABLE secret (id INTEGER PRIMARY KEY, value TEXT);
+		CREATE VIEW names AS SELECT name FROM entries;
+		INSERT INTO secret (value) VALUES ('hidden');`)
+	require.NoError(t, err)
+	tx, err := client.Begin()
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback() }()
+	for id := 1; id <= rowCount; id++ {
+		_, err = tx.Exec("INSERT INTO entries (id, name, data) VALUES (?, ?, ?)", id, fmt.Sprintf("entry-%d", id), []byte{byte(id)})
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+	require.NoError(t, client.Close())
+
+	in, err := os.Open(dbPath)
+	require.NoError(t, err)
+	defer in.Close() //nolint: errcheck
+	out, err := os.Create(dbPath + ".zst")
+	require.NoError(t, err)
+	defer out.Close() //nolint: errcheck
+	require.NoError(t, sqlitezstd.CompressDB(t.Context(), in, out, sqlitezstd.CompressOptions{}))
+	require.NoError(t, out.Close())
+	return dbPath + ".zst"
+}
+
+// newServer serves the database at zstPath as "test" with cfg.
+func newServer(t *testing.T, zstPath string, cfg server.Config) *httptest.Server {
+	t.Helper()
+
+	cfg.Databases = map[string]string{"test": zstPath}
+	handler, err := server.NewHandler(t.Context(), cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, handler.Close()) })
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// get fetches path and decodes its JSON response into v, returning the
+// status code.
+func get(t *testing.T, srv *httptest.Server, path string, v any) int {
+	t.Helper()
+
+	resp, err := srv.Client().Get(srv.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close() //nolint: errcheck
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	return resp.StatusCode
+}
+
+// query posts body as a query of the test database, returning the status
+// code and the result or error message.
+func query(t *testing.T, srv *httptest.Server, body string) (int, server.Result, string) {
+	t.Helper()
+
+	resp, err := srv.Client().Post(srv.URL+"/databases/test/query", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close() //nolint: errcheck
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var response struct {
+		server.Result
+		Error string `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(data, &response), string(data))
+	return resp.StatusCode, response.Result, response.Error
+}
+
+func TestHandler(t *testing.T) {
+	zstPath := createDatabase(t)
+	srv := newServer(t, zstPath, server.Config{MaxRows: 100, AllowAllFunctions: true})
+
+	var names []string
+	assert.Equal(t, http.StatusOK, get(t, srv, "/databases", &names))
+	assert.Equal(t, []string{"test"}, names)
+
+	var tables []server.Table
+	assert.Equal(t, http.StatusOK, get(t, srv, "/databases/test/tables", &tables))
+	assert.Equal(t, []server.Table{{"entries", "table"}, {"names", "view"}, {"secret", "table"}}, tables)
+
+	code, result, msg := query(t, srv, `{"sql": "SELECT id, name, data, NULL AS missing FROM entries WHERE id BETWEEN ? AND ? ORDER BY id", "params": [2, 3]}`)
+	require.Equal(t, http.StatusOK, code, msg)
+	assert.Equal(t, []string{"id", "name", "data", "missing"}, result.Columns)
+	assert.Equal(t, [][]any{{2.0, "entry-2", "Ag==", nil}, {3.0, "entry-3", "Aw==", nil}}, result.Rows)
+	assert.False(t, result.Truncated)
+
+	code, result, msg = query(t, srv, `{"sql": "SELECT name FROM names WHERE name = :name OR name = $other", "params": {"name": "entry-7", "$other": "entry-8"}}`)
+	require.Equal(t, http.StatusOK, code, msg)
+	assert.Equal(t, [][]any{{"entry-7"}, {"entry-8"}}, result.Rows)
+
+	code, result, msg = query(t, srv, `{"sql": "SELECT id FROM entries"}`)
+	require.Equal(t, http.StatusOK, code, msg)
+	assert.Len(t, result.Rows, 100)
+	assert.True(t, result.Truncated)
+
+	code, result, msg = query(t, srv, `{"sql": "SELECT id FROM entries", "max_rows": 5}`)
+	require.Equal(t, http.StatusOK, code, msg)
+	assert.Len(t, result.Rows, 5)
+	assert.True(t, result.Truncated)
+
+	code, result, msg = query(t, srv, `{"sql": "SELECT 1e999, 0.5, upper('x')"}`)
+	require.Equal(t, http.StatusOK, code, msg)
+	assert.Equal(t, [][]any{{"+Inf", 0.5, "X"}}, result.Rows)
+
+	var stats sqlitezstd.DatabaseStats
+	assert.Equal(t, http.StatusOK, get(t, srv, "/databases/test/stats", &stats))
+	assert.Positive(t, stats.OpenFiles)
+	assert.Positive(t, stats.BytesRead)
+
+	for _, tc := range []struct {
+		name string
+		body string
+		code int
+		want string
+	}{
+		{"delete", `{"sql": "DELETE FROM entries"}`, http.StatusForbidden, "not authorized"},
+		{"pragma", `{"sql": "PRAGMA cache_size = 1"}`, http.StatusForbidden, "not authorized"},
+		{"attach", `{"sql": "ATTACH DATABASE 'other.db' AS other"}`, http.StatusForbidden, "not authorized"},
+		{"syntax", `{"sql": "SELEKT 1"}`, http.StatusBadRequest, "syntax error"},
+		{"no sql", `{}`, http.StatusBadRequest, "no sql"},
+		{"unknown field", `{"query": "SELECT 1"}`, http.StatusBadRequest, "unknown field"},
+		{"bad params", `{"sql": "SELECT ?", "params": [[1]]}`, http.StatusBadRequest, "parameter 1"},
+		{"scalar params", `{"sql": "SELECT ?", "params": 1}`, http.StatusBadRequest, "array or an object"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, msg := query(t, srv, tc.body)
+			assert.Equal(t, tc.code, code)
+			assert.Contains(t, msg, tc.want)
+		})
+	}
+
+	var response struct{ Error string }
+	assert.Equal(t, http.StatusNotFound, get(t, srv, "/databases/missing/tables", &response))
+	assert.Contains(t, response.Error, `unknown database "missing"`)
+}
+
+func TestHandlerAllowList(t *testing.T) {
+	zstPath := createDatabase(t)
+	srv := newServer(t, zstPath, server.Config{
+		Tables:    []string{"Entries", "names"},
+		Functions: []string{"upper", "count"},
+	})
+
+	var tables []server.Table
+	assert.Equal(t, http.StatusOK, get(t, srv, "/databases/test/tables", &tables))
+	assert.Equal(t, []server.Table{{"entries", "table"}, {"names", "view"}}, tables)
+
+	code, result, msg := query(t, srv, `{"sql": "SELECT upper(name), count(*) FROM names"}`)
+	require.Equal(t, http.StatusOK, code, msg)
+	assert.Equal(t, [][]any{{"ENTRY-1", float64(rowCount)}}, result.Rows)
+
+	for _, sql := range []string{
+		"SELECT value FROM secret",
+		"SELECT count(*) FROM secret",
+		"SELECT lower(name) FROM entries",
+		"SELECT name FROM sqlite_schema",
+	} {
+		code, _, msg := query(t, srv, fmt.Sprintf(`{"sql": %q}`, sql))
+		assert.Equal(t, http.StatusForbidden, code, sql)
+		assert.Regexp(t, "not authorized|prohibited", msg, sql)
+	}
+
+	// Without a list no function may be called.
+	srv = newServer(t, zstPath, server.Config{})
+	code, _, msg = query(t, srv, `{"sql": "SELECT upper(name) FROM entries"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Regexp(t, "not authorized|prohibited", msg)
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	zstPath := createDatabase(t)
+	srv := newServer(t, zstPath, server.Config{Timeout: 50 * time.Millisecond, Functions: []string{"count"}})
+
+	start := time.Now()
+	code, _, msg := query(t, srv, `{"sql": "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT count(*) FROM c"}`)
+	assert.Equal(t, http.StatusGatewayTimeout, code)
+	assert.Contains(t, msg, "timeout")
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	// The connection is usable after the interrupted query.
+	code, _, msg = query(t, srv, `{"sql": "SELECT count(*) FROM entries"}`)
+	assert.Equal(t, http.StatusOK, code, msg)
+}
+
+func TestNewHandlerError(t *testing.T) {
+	_, err := server.NewHandler(t.Context(), server.Config{})
+	assert.ErrorContains(t, err, "no databases")
+
+	_, err = server.NewHandler(t.Context(), server.Config{Databases: map[string]string{"a/b": createDatabase(t)}})
+	assert.ErrorContains(t, err, "invalid database name")
+
+	_, err = server.NewHandler(t.Context(), server.Config{Databases: map[string]string{"missing": filepath.Join(t.TempDir(), "missing.sqlite.zst")}})
+	assert.ErrorContains(t, err, "database missing")
+}
@@ -0,0 +1,536 @@
+// Package sqlitezstd provides read-only access to SQLite databases
+// compressed with the Zstandard seekable format.
+//
+// Importing the package registers the "zstd" VFS with a default SQLite
+// driver, ncruces/go-sqlite3:
+//
+//	import _ "github.com/paulstuart/sqlitezstd"
+//
+//	db, err := sql.Open("sqlite3", "file:database.sqlite.zst?vfs=zstd")
+//
+// Build with the sqlitezstd_mattn or sqlitezstd_modernc tag to register
+// the VFS with mattn/go-sqlite3 or modernc.org/sqlite instead. DriverName
+// and VFSName report the names to use with whichever driver was selected.
+//
+// Failures are reported to SQLite with the closest extended result code:
+// CANTOPEN, IOERR_READ, IOERR_SHORT_READ, CORRUPT, AUTH or INTERRUPT. With
+// ncruces/go-sqlite3, the underlying error of a failed open, such as an
+// *ErrRemoteStatus, is also available from the driver's error through
+// errors.As. Otherwise only the result code is passed on.
+//
+// Each database can be configured with zstd_* URI parameters, which work
+// the same with every driver:
+//
+//	file:database.sqlite.zst?vfs=zstd&zstd_cache=64MiB&zstd_timeout=5s
+//
+// See WithCacheSize, WithReadAhead, WithAdaptiveReadAhead,
+// WithReadAheadConcurrency, WithTimeout, WithConnectTimeout,
+// WithReadTimeout, WithRetryPolicy, WithReopenOnChange, WithDiskCache,
+// WithMmap and WithVerifyChecksums.
+//
+// Remote reads stop when the query that needs them is canceled or
+// interrupted, and the query fails with INTERRUPT.
+//
+// The driver adapters are also available on their own under driver/.
+package sqlitezstd
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/paulstuart/sqlitezstd/internal/core"
+)
+
+type (
+	// File is an open Zstandard seekable compressed database.
+	File = core.File
+
+	// Option configures how Open reads a compressed database.
+	Option = core.Option
+
+	// Frame describes a frame of a compressed database: the range of the
+	// decompressed database it holds, and where it is stored.
+	Frame = core.Frame
+
+	// CompressOptions configures CompressDB. The zero value selects the
+	// defaults.
+	CompressOptions = core.CompressOptions
+
+	// ReadSeeker is an io.ReadSeeker implementation based on an io.ReaderAt
+	// (and an int64 size).
+	ReadSeeker = core.ReadSeeker
+
+	// ErrRemoteStatus reports an unexpected HTTP response from a remote
+	// source.
+	ErrRemoteStatus = core.ErrRemoteStatus
+
+	// ErrCorruptFrame reports a frame that could not be decompressed or did
+	// not match the seek table.
+	ErrCorruptFrame = core.ErrCorruptFrame
+
+	// ReaderAtContext is implemented by sources whose reads can be
+	// cancelled. Such reads are bounded by the timeout set by WithTimeout.
+	ReaderAtContext = core.ReaderAtContext
+
+	// SourceFactory opens the compressed bytes of a database and returns
+	// them as an io.ReaderAt together with their size.
+	SourceFactory = core.SourceFactory
+
+	// DatabaseStats is a snapshot of the work done for one database name.
+	DatabaseStats = core.DatabaseStats
+
+	// LatencyHistogram is a snapshot of a distribution of durations.
+	LatencyHistogram = core.LatencyHistogram
+
+	// Tracer receives an event for every traced operation once it
+	// completes.
+	Tracer = core.Tracer
+
+	// TraceEvent describes a completed operation.
+	TraceEvent = core.TraceEvent
+
+	// TraceOp names an operation reported to a Tracer.
+	TraceOp = core.TraceOp
+
+	// Auth authorizes the requests of the built-in HTTP source.
+	Auth = core.Auth
+
+	// CredentialsProvider supplies the header fields that authorize
+	// requests to a remote source, and refreshes them after a 401
+	// Unauthorized response.
+	CredentialsProvider = core.CredentialsProvider
+
+	// CredentialsFunc adapts a function to a CredentialsProvider.
+	CredentialsFunc = core.CredentialsFunc
+
+	// RetryPolicy controls how the built-in HTTP source retries requests
+	// that fail transiently, with exponential backoff and jitter.
+	RetryPolicy = core.RetryPolicy
+
+	// S3Config configures the built-in s3:// source: region, endpoint,
+	// path-style addressing and credentials.
+	S3Config = core.S3Config
+
+	// S3Credentials are the keys that sign requests to an object store.
+	S3Credentials = core.S3Credentials
+
+	// S3CredentialsProvider supplies the keys that sign requests to an
+	// object store, and refreshes them after a refused request.
+	S3CredentialsProvider = core.S3CredentialsProvider
+
+	// S3CredentialsFunc adapts a function to an S3CredentialsProvider.
+	S3CredentialsFunc = core.S3CredentialsFunc
+
+	// Authorizer decides whether a statement being prepared may perform
+	// an action, as SQLite's sqlite3_set_authorizer callback does.
+	Authorizer = core.Authorizer
+
+	// AuthorizerAction is a SQLite authorizer action code.
+	AuthorizerAction = core.AuthorizerAction
+
+	// AuthorizerResult is the decision of an Authorizer.
+	AuthorizerResult = core.AuthorizerResult
+)
+
+// EnvS3Credentials reads the keys that sign requests to an object store
+// from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// environment variables. It is the default S3CredentialsProvider.
+var EnvS3Credentials = core.EnvS3Credentials
+
+// The operations reported to a Tracer.
+const (
+	TraceSourceOpen    = core.TraceSourceOpen
+	TraceSeekTableLoad = core.TraceSeekTableLoad
+	TraceFetch         = core.TraceFetch
+	TraceDecompress    = core.TraceDecompress
+	TraceCacheLookup   = core.TraceCacheLookup
+)
+
+// The authorizer action codes.
+const (
+	ActionCreateIndex       = core.ActionCreateIndex
+	ActionCreateTable       = core.ActionCreateTable
+	ActionCreateTempIndex   = core.ActionCreateTempIndex
+	ActionCreateTempTable   = core.ActionCreateTempTable
+	ActionCreateTempTrigger = core.ActionCreateTempTrigger
+	ActionCreateTempView    = core.ActionCreateTempView
+	ActionCreateTrigger     = core.ActionCreateTrigger
+	ActionCreateView        = core.ActionCreateView
+	ActionDelete            = core.ActionDelete
+	ActionDropIndex         = core.ActionDropIndex
+	ActionDropTable         = core.ActionDropTable
+	ActionDropTempIndex     = core.ActionDropTempIndex
+	ActionDropTempTable     = core.ActionDropTempTable
+	ActionDropTempTrigger   = core.ActionDropTempTrigger
+	ActionDropTempView      = core.ActionDropTempView
+	ActionDropTrigger       = core.ActionDropTrigger
+	ActionDropView          = core.ActionDropView
+	ActionInsert            = core.ActionInsert
+	ActionPragma            = core.ActionPragma
+	ActionRead              = core.ActionRead
+	ActionSelect            = core.ActionSelect
+	ActionTransaction       = core.ActionTransaction
+	ActionUpdate            = core.ActionUpdate
+	ActionAttach            = core.ActionAttach
+	ActionDetach            = core.ActionDetach
+	ActionAlterTable        = core.ActionAlterTable
+	ActionReindex           = core.ActionReindex
+	ActionAnalyze           = core.ActionAnalyze
+	ActionCreateVTable      = core.ActionCreateVTable
+	ActionDropVTable        = core.ActionDropVTable
+	ActionFunction          = core.ActionFunction
+	ActionSavepoint         = core.ActionSavepoint
+	ActionRecursive         = core.ActionRecursive
+)
+
+// The decisions of an Authorizer.
+const (
+	AuthorizerOK     = core.AuthorizerOK
+	AuthorizerDeny   = core.AuthorizerDeny
+	AuthorizerIgnore = core.AuthorizerIgnore
+)
+
+var (
+	// ErrNotSeekable reports a source that does not end with a seek table,
+	// such as an uncompressed database or a plain Zstandard file.
+	ErrNotSeekable = core.ErrNotSeekable
+
+	// ErrCorruptSeekTable reports a seek table that cannot describe the
+	// source it ends.
+	ErrCorruptSeekTable = core.ErrCorruptSeekTable
+
+	// ErrNoChecksums reports a database opened with checksum verification
+	// required whose seek table has no checksums.
+	ErrNoChecksums = core.ErrNoChecksums
+
+	// ErrChecksumMismatch reports a frame whose contents do not match the
+	// checksum in the seek table. It is wrapped in an ErrCorruptFrame.
+	ErrChecksumMismatch = core.ErrChecksumMismatch
+
+	// ErrUnknownScheme reports a name whose URI scheme has no registered
+	// source.
+	ErrUnknownScheme = core.ErrUnknownScheme
+
+	// ErrSourceChanged reports a remote source that was replaced after the
+	// database was opened, detected from its ETag or Last-Modified time,
+	// or a local file mapped WithMmap that was truncated.
+	ErrSourceChanged = core.ErrSourceChanged
+
+	// ErrInterrupted reports a source read stopped because the SQLite
+	// connection was interrupted.
+	ErrInterrupted = core.ErrInterrupted
+
+	// ErrNotSQLite reports a CompressDB source that does not start with a
+	// SQLite database header.
+	ErrNotSQLite = core.ErrNotSQLite
+)
+
+// DefaultPagesPerFrame is the number of database pages CompressDB
+// compresses into each frame by default.
+const DefaultPagesPerFrame = core.DefaultPagesPerFrame
+
+// Open opens the compressed database name for reading, independently of
+// any SQLite driver.
+func Open(ctx context.Context, name string, opts ...Option) (*File, error) {
+	return core.Open(ctx, name, opts...)
+}
+
+// DSN returns the data source name opening the compressed database name
+// with the zstd VFS of the selected driver, such as
+// file:database.sqlite.zst?vfs=zstd. The characters of name SQLite would
+// take for the start of the query or fragment, or for an escape, are
+// percent-encoded; further URI parameters can be appended with "&".
+func DSN(name string) string {
+	return "file:" + dsnEscaper.Replace(name) + "?vfs=" + VFSName()
+}
+
+// dsnEscaper percent-encodes the characters of a database name that end
+// the path of a URI filename.
+var dsnEscaper = strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
+
+// CompressDB compresses the SQLite database read from src into the
+// seekable format the VFS reads, written to dst. Frames are cut on the
+// page boundaries of the database, CompressOptions.PagesPerFrame pages
+// each, so that a page read decompresses a single frame.
+func CompressDB(ctx context.Context, src io.Reader, dst io.Writer, opts CompressOptions) error {
+	return core.CompressDB(ctx, src, dst, opts)
+}
+
+// PageSize returns the page size recorded in the header of the SQLite
+// database read from r, such as a File, or ErrNotSQLite if r does not
+// hold a SQLite database.
+func PageSize(r io.ReaderAt) (int, error) {
+	return core.PageSize(r)
+}
+
+// RegisterSource makes factory responsible for opening every database name
+// of the form scheme://... The built-in "file", "http", "https" and "s3"
+// sources can be replaced the same way. Names without a scheme are local
+// files.
+func RegisterSource(scheme string, factory SourceFactory) {
+	core.RegisterSource(scheme, factory)
+}
+
+// RegisterFS makes the files of fsys, such as an embed.FS, available as
+// name/path: a database embedded as data.sqlite.zst in a filesystem
+// registered as "assets" opens as file:assets/data.sqlite.zst?vfs=zstd.
+// Files are read with ReadAt when they implement io.ReaderAt, and with
+// Seek and Read otherwise. A nil fsys removes the registration.
+func RegisterFS(name string, fsys fs.FS) {
+	core.RegisterFS(name, fsys)
+}
+
+// RegisterReaderAt makes the database name, as in file:name?vfs=zstd,
+// read its size compressed bytes from r, such as a bytes.Reader over a
+// buffer, instead of a local file. A nil r removes the registration. r is
+// never closed.
+func RegisterReaderAt(name string, r io.ReaderAt, size int64) {
+	core.RegisterReaderAt(name, r, size)
+}
+
+// RegisterAuth authorizes the requests for the remote databases matching
+// pattern, either the URL of a database or a host with or without a port,
+// with auth. The most specific pattern applies. A nil auth removes the
+// registration. Databases opened with WithAuth use that Auth instead.
+func RegisterAuth(pattern string, auth *Auth) {
+	core.RegisterAuth(pattern, auth)
+}
+
+// SetS3Config sets the S3Config of the s3://bucket/key databases opened
+// afterwards without WithS3Config. Empty fields are read from the AWS_*
+// environment variables.
+func SetS3Config(cfg S3Config) {
+	core.SetS3Config(cfg)
+}
+
+// RegisterHTTPClient makes the built-in HTTP source request the remote
+// databases matching pattern, as for RegisterAuth, with client. A nil
+// client removes the registration. Databases opened with WithHTTPClient
+// use that client instead.
+func RegisterHTTPClient(pattern string, client *http.Client) {
+	core.RegisterHTTPClient(pattern, client)
+}
+
+// SetHTTPClient sets the client of the built-in HTTP source for the
+// remote databases opened afterwards without WithHTTPClient or a
+// registered client. A nil client selects the built-in one.
+func SetHTTPClient(client *http.Client) {
+	core.SetHTTPClient(client)
+}
+
+// NewHTTPClient returns a client like the built-in one, which honors
+// WithConnectTimeout, using tlsConfig for TLS, e.g. to trust a private CA
+// or to present a client certificate.
+func NewHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return core.NewHTTPClient(tlsConfig)
+}
+
+// WithDecoderConcurrency limits the number of frames a database's decoder
+// decompresses at the same time. Databases opened with the same decoder
+// limits share a decoder, which is closed when the last of them closes.
+func WithDecoderConcurrency(n int) Option {
+	return core.WithDecoderConcurrency(n)
+}
+
+// WithDecoderMaxMemory limits the size a single frame may decompress to.
+func WithDecoderMaxMemory(n uint64) Option {
+	return core.WithDecoderMaxMemory(n)
+}
+
+// WithCacheSize gives the database a frame cache of its own holding up to
+// size decompressed bytes, instead of the process-wide cache. A size of 0
+// disables caching. It is the zstd_cache URI parameter.
+func WithCacheSize(size int64) Option {
+	return core.WithCacheSize(size)
+}
+
+// WithReadAhead makes every cache miss also decompress up to frames
+// following frames. It is the zstd_readahead URI parameter.
+func WithReadAhead(frames int) Option {
+	return core.WithReadAhead(frames)
+}
+
+// WithAdaptiveReadAhead makes cache misses read ahead a window of frames
+// that doubles, up to maxFrames, while the database is read sequentially,
+// and halves on other misses. It is the zstd_readahead_max URI parameter.
+func WithAdaptiveReadAhead(maxFrames int) Option {
+	return core.WithAdaptiveReadAhead(maxFrames)
+}
+
+// WithReadAheadConcurrency splits the frames read on a cache miss into up
+// to n reads from the source made in parallel. It is the
+// zstd_readahead_concurrency URI parameter.
+func WithReadAheadConcurrency(n int) Option {
+	return core.WithReadAheadConcurrency(n)
+}
+
+// WithTimeout bounds opening the database and each read from its source.
+// It is the zstd_timeout URI parameter.
+func WithTimeout(timeout time.Duration) Option {
+	return core.WithTimeout(timeout)
+}
+
+// WithConnectTimeout bounds the time the built-in HTTP source spends
+// establishing each connection. It is the zstd_connect_timeout URI
+// parameter.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return core.WithConnectTimeout(timeout)
+}
+
+// WithReadTimeout bounds each read from the source after the database is
+// open, replacing the timeout set by WithTimeout for those reads. It is
+// the zstd_read_timeout URI parameter.
+func WithReadTimeout(timeout time.Duration) Option {
+	return core.WithReadTimeout(timeout)
+}
+
+// DefaultRetryPolicy returns the RetryPolicy of databases opened without
+// WithRetryPolicy: 3 retries of network errors and of 408, 429, 500, 502,
+// 503 and 504 responses, backing off from 100ms to 5s.
+func DefaultRetryPolicy() RetryPolicy {
+	return core.DefaultRetryPolicy()
+}
+
+// WithRetryPolicy makes the built-in HTTP source retry the requests for
+// the database as policy says. The number of retries is the zstd_retries
+// URI parameter.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return core.WithRetryPolicy(policy)
+}
+
+// WithMmap makes local files be read through a read-only memory mapping
+// instead of a system call per read, on Linux. A mapped file truncated
+// while open fails reads with ErrSourceChanged. It is the zstd_mmap URI
+// parameter.
+func WithMmap(mmap bool) Option {
+	return core.WithMmap(mmap)
+}
+
+// WithReopenOnChange makes a read that finds the remote source replaced
+// since the database was opened reopen it, instead of failing with
+// ErrSourceChanged. SQLite may still hold pages of the old version in its
+// page cache. It is the zstd_reopen URI parameter.
+func WithReopenOnChange(reopen bool) Option {
+	return core.WithReopenOnChange(reopen)
+}
+
+// WithVerifyChecksums requires and verifies frame checksums when verify is
+// set, and skips verification when it is not. By default, checksums are
+// verified when present. It is the zstd_verify URI parameter.
+func WithVerifyChecksums(verify bool) Option {
+	return core.WithVerifyChecksums(verify)
+}
+
+// WithAuth authorizes the requests for the database with auth instead of
+// the Auth registered for its URL or host.
+func WithAuth(auth Auth) Option {
+	return core.WithAuth(auth)
+}
+
+// WithDiskCache stores the compressed bytes read from the remote source of
+// the database in dir, holding up to maxSize bytes (DefaultDiskCacheSize if
+// 0), so that later opens, in any process sharing dir, do not fetch them
+// again. Sources served without an ETag or Last-Modified time are not
+// cached. It is the zstd_disk_cache URI parameter, and maxSize the
+// zstd_disk_cache_size one.
+func WithDiskCache(dir string, maxSize int64) Option {
+	return core.WithDiskCache(dir, maxSize)
+}
+
+// WithS3Config configures the s3:// source of the database with cfg
+// instead of the S3Config set by SetS3Config. The zstd_s3_region,
+// zstd_s3_endpoint and zstd_s3_path_style URI parameters override its
+// fields.
+func WithS3Config(cfg S3Config) Option {
+	return core.WithS3Config(cfg)
+}
+
+// WithHTTPClient makes the built-in HTTP source request the database with
+// client instead of the registered client or the one set by SetHTTPClient.
+func WithHTTPClient(client *http.Client) Option {
+	return core.WithHTTPClient(client)
+}
+
+// WithTracer reports the operations on the database to t instead of the
+// Tracer set by SetTracer. A nil Tracer disables tracing.
+func WithTracer(t Tracer) Option {
+	return core.WithTracer(t)
+}
+
+// WithLogger logs the activity on the database to logger instead of the
+// Logger set by SetLogger. A nil Logger discards every record.
+func WithLogger(logger *slog.Logger) Option {
+	return core.WithLogger(logger)
+}
+
+// DefaultCacheSize is the default budget, in decompressed bytes, of the
+// frame cache shared by every open database.
+const DefaultCacheSize = core.DefaultCacheSize
+
+// SetCacheSize sets the budget, in decompressed bytes, of the frame cache
+// shared by every open database. Frames are cached by source and frame
+// index, so connections to the same database reuse each other's work. A
+// size of 0 disables the cache.
+func SetCacheSize(size int64) {
+	core.SetCacheSize(size)
+}
+
+// DefaultDiskCacheSize is the budget, in bytes, of a disk cache enabled
+// without one.
+const DefaultDiskCacheSize = core.DefaultDiskCacheSize
+
+// SetDiskCache stores the compressed bytes read from the remote sources of
+// the databases opened afterwards without WithDiskCache in dir, holding up
+// to maxSize bytes. The least recently used ranges are evicted, and
+// processes may share dir. An empty dir, the default, disables it.
+func SetDiskCache(dir string, maxSize int64) {
+	core.SetDiskCache(dir, maxSize)
+}
+
+// Stats returns a snapshot of the statistics of every database opened
+// since the process started, keyed by database name as RedactedName
+// returns it: bytes fetched from the source, frames decompressed, cache
+// hits and misses, and latencies. The counters only go up until ResetStats.
+func Stats() map[string]DatabaseStats {
+	return core.Stats()
+}
+
+// ResetStats zeroes the statistics of the database name, except its number
+// of open Files, and drops them from Stats if no File is open on it.
+func ResetStats(name string) {
+	core.ResetStats(name)
+}
+
+// RedactedName returns the database name as it is logged and keyed by
+// Stats: for a URL, without its password, query or fragment, which may
+// carry credentials such as the signature of a presigned URL.
+func RedactedName(name string) string {
+	return core.RedactedName(name)
+}
+
+// PublishExpvar publishes the result of Stats as the expvar variable name,
+// which makes it available from /debug/vars. Like expvar.Publish, it
+// panics if name is already in use.
+func PublishExpvar(name string) {
+	core.PublishExpvar(name)
+}
+
+// SetTracer sets the Tracer of the databases opened afterwards without
+// WithTracer, whichever driver opens them. A nil Tracer disables tracing.
+func SetTracer(t Tracer) {
+	core.SetTracer(t)
+}
+
+// SetLogger sets the Logger of the databases opened afterwards without
+// WithLogger, whichever driver opens them. Opens, source reads and retries
+// are logged at debug level; swallowed errors and fallbacks at warn level.
+// A nil Logger, the default, discards every record.
+func SetLogger(logger *slog.Logger) {
+	core.SetLogger(logger)
+}
@@ -0,0 +1,409 @@
+package sqlitezstd_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paulstuart/sqlitezstd"
+)
+
+const rowCount = 10_000
+
+// createDatabase builds a small database with the default driver and
+// compresses it into the seekable format, returning the .zst path.
+func createDatabase(t *testing.T) string {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "test.sqlite")
+
+	client, err := sql.Open(sqlitezstd.DriverName, "file:"+dbPath)
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	_, err = client.Exec(`CREATE TABLE entries (id INTEGER PRIMARY KEY, name TEXT);`)
+	require.NoError(t, err)
+
+	tx, err := client.Begin()
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare("INSERT INTO entries (id, name) VALUES (?, ?)")
+	require.NoError(t, err)
+	defer stmt.Close() //nolint: errcheck
+
+	for id := 1; id <= rowCount; id++ {
+		_, err = stmt.Exec(id, fmt.Sprintf("entry-%d", id))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+	require.NoError(t, client.Close())
+
+	zstPath := dbPath + ".zst"
+	compressFile(t, dbPath, zstPath)
+	return zstPath
+}
+
+func compressFile(t *testing.T, src, dst string) {
+	t.Helper()
+
+	in, err := os.Open(src)
+	require.NoError(t, err)
+	defer in.Close() //nolint: errcheck
+
+	out, err := os.Create(dst)
+	require.NoError(t, err)
+	defer out.Close() //nolint: errcheck
+
+	require.NoError(t, sqlitezstd.CompressDB(t.Context(), in, out, sqlitezstd.CompressOptions{}))
+	require.NoError(t, out.Close())
+}
+
+func TestRootImportRegistersVFS(t *testing.T) {
+	zstPath := createDatabase(t)
+
+	client, err := sql.Open(sqlitezstd.DriverName, fmt.Sprintf("file:%s?vfs=%s", zstPath, sqlitezstd.VFSName()))
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	var count int64
+	require.NoError(t, client.QueryRow("SELECT COUNT(*) FROM entries;").Scan(&count))
+	assert.EqualValues(t, rowCount, count)
+}
+
+func TestRegisterFS(t *testing.T) {
+	compressed, err := os.ReadFile(createDatabase(t))
+	require.NoError(t, err)
+
+	sqlitezstd.RegisterFS("assets", fstest.MapFS{"data.sqlite.zst": {Data: compressed}})
+	defer sqlitezstd.RegisterFS("assets", nil)
+
+	client, err := sql.Open(sqlitezstd.DriverName, "file:assets/data.sqlite.zst?vfs="+sqlitezstd.VFSName())
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	var count int64
+	require.NoError(t, client.QueryRow("SELECT COUNT(*) FROM entries;").Scan(&count))
+	assert.EqualValues(t, rowCount, count)
+}
+
+func TestRegisterReaderAt(t *testing.T) {
+	compressed, err := os.ReadFile(createDatabase(t))
+	require.NoError(t, err)
+
+	sqlitezstd.RegisterReaderAt("payload", bytes.NewReader(compressed), int64(len(compressed)))
+	defer sqlitezstd.RegisterReaderAt("payload", nil, 0)
+
+	client, err := sql.Open(sqlitezstd.DriverName, "file:payload?vfs="+sqlitezstd.VFSName())
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	var count int64
+	require.NoError(t, client.QueryRow("SELECT COUNT(*) FROM entries;").Scan(&count))
+	assert.EqualValues(t, rowCount, count)
+}
+
+func TestDSN(t *testing.T) {
+	assert.Equal(t, "file:data/a%3fb%23c%25d.sqlite.zst?vfs="+sqlitezstd.VFSName(), sqlitezstd.DSN("data/a?b#c%d.sqlite.zst"))
+
+	zstPath := filepath.Join(t.TempDir(), "odd?#%name.sqlite.zst")
+	require.NoError(t, os.Rename(createDatabase(t), zstPath))
+	client, err := sql.Open(sqlitezstd.DriverName, sqlitezstd.DSN(zstPath)+"&zstd_cache=0")
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	var count int64
+	require.NoError(t, client.QueryRow("SELECT COUNT(*) FROM entries;").Scan(&count))
+	assert.EqualValues(t, rowCount, count)
+}
+
+func TestSetAuthorizer(t *testing.T) {
+	zstPath := createDatabase(t)
+
+	client, err := sql.Open(sqlitezstd.DriverName, fmt.Sprintf("file:%s?vfs=%s", zstPath, sqlitezstd.VFSName()))
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	conn, err := client.Conn(t.Context())
+	require.NoError(t, err)
+	defer conn.Close() //nolint: errcheck
+
+	var functions []string
+	require.NoError(t, conn.Raw(func(driverConn any) error {
+		return sqlitezstd.SetAuthorizer(driverConn, func(action sqlitezstd.AuthorizerAction, arg1, arg2, database, _ string) sqlitezstd.AuthorizerResult {
+			switch {
+			case action == sqlitezstd.ActionFunction:
+				functions = append(functions, arg2)
+				return sqlitezstd.AuthorizerOK
+			case action == sqlitezstd.ActionRead && arg2 == "name":
+				return sqlitezstd.AuthorizerIgnore
+			case action == sqlitezstd.ActionRead && database == "main":
+				return sqlitezstd.AuthorizerOK
+			case action == sqlitezstd.ActionSelect:
+				return sqlitezstd.AuthorizerOK
+			default:
+				return sqlitezstd.AuthorizerDeny
+			}
+		})
+	}))
+
+	var name sql.NullString
+	require.NoError(t, conn.QueryRowContext(t.Context(), "SELECT upper(name) FROM entries WHERE id = 1").Scan(&name))
+	assert.False(t, name.Valid)
+	assert.Equal(t, []string{"upper"}, functions)
+
+	_, err = conn.ExecContext(t.Context(), "PRAGMA cache_size = 10")
+	assert.ErrorContains(t, err, "not authorized")
+
+	require.NoError(t, conn.Raw(func(driverConn any) error {
+		return sqlitezstd.SetAuthorizer(driverConn, nil)
+	}))
+	require.NoError(t, conn.QueryRowContext(t.Context(), "SELECT name FROM entries WHERE id = 1").Scan(&name))
+	assert.Equal(t, "entry-1", name.String)
+
+	assert.Error(t, sqlitezstd.SetAuthorizer(struct{}{}, nil))
+}
+
+func TestOpen(t *testing.T) {
+	zstPath := createDatabase(t)
+
+	file, err := sqlitezstd.Open(t.Context(), zstPath)
+	require.NoError(t, err)
+	defer file.Close() //nolint: errcheck
+
+	header := make([]byte, 16)
+	_, err = file.ReadAt(header, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "SQLite format 3\x00", string(header))
+	assert.Zero(t, file.Size()%4096)
+}
+
+func TestConnectionCycleDoesNotLeak(t *testing.T) {
+	zstPath := createDatabase(t)
+
+	client, err := sql.Open(sqlitezstd.DriverName, fmt.Sprintf("file:%s?vfs=%s", zstPath, sqlitezstd.VFSName()))
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	// Every query runs on a fresh connection that is closed afterwards.
+	client.SetMaxIdleConns(0)
+
+	var count int64
+	require.NoError(t, client.QueryRow("SELECT COUNT(*) FROM entries;").Scan(&count))
+	before := runtime.NumGoroutine()
+
+	for range 10_000 {
+		require.NoError(t, client.QueryRow("SELECT name FROM entries WHERE id = 1;").Scan(new(string)))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func TestURIParameters(t *testing.T) {
+	zstPath := createDatabase(t)
+
+	for _, tc := range []struct {
+		params string
+		valid  bool
+	}{
+		{"zstd_cache=64MiB&zstd_readahead=4&zstd_timeout=5s&zstd_verify=1", true},
+		{"zstd_cache=0&zstd_verify=0", true},
+		{"cache=shared&zstd_readahead=2", true},
+		{"zstd_mmap=1&zstd_cache=0", true},
+		{"zstd_bogus=1", false},
+		{"zstd_cache=lots", false},
+		{"zstd_timeout=-1s", false},
+	} {
+		t.Run(tc.params, func(t *testing.T) {
+			client, err := sql.Open(sqlitezstd.DriverName, fmt.Sprintf("file:%s?vfs=%s&%s", zstPath, sqlitezstd.VFSName(), tc.params))
+			require.NoError(t, err)
+			defer client.Close() //nolint: errcheck
+
+			var count int64
+			err = client.QueryRow("SELECT COUNT(*) FROM entries;").Scan(&count)
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.EqualValues(t, rowCount, count)
+		})
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	zstPath := createDatabase(t)
+
+	compressed, err := os.ReadFile(zstPath)
+	require.NoError(t, err)
+	for i := len(compressed) / 2; i < len(compressed)/2+64; i++ {
+		compressed[i] ^= 0x55
+	}
+	corruptPath := filepath.Join(t.TempDir(), "corrupt.sqlite.zst")
+	require.NoError(t, os.WriteFile(corruptPath, compressed, 0o600))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name string
+		path string
+		want string
+	}{
+		{"not seekable", strings.TrimSuffix(zstPath, ".zst"), "unable to open database file"},
+		{"forbidden", server.URL + "/db.sqlite.zst", "authorization denied"},
+		{"corrupt frame", corruptPath, "malformed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := sql.Open(sqlitezstd.DriverName, fmt.Sprintf("file:%s?vfs=%s", tc.path, sqlitezstd.VFSName()))
+			require.NoError(t, err)
+			defer client.Close() //nolint: errcheck
+
+			var count int64
+			err = client.QueryRow("SELECT COUNT(*) FROM entries;").Scan(&count)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+// opCounter counts the events it receives by operation.
+type opCounter struct {
+	mu  sync.Mutex
+	ops map[sqlitezstd.TraceOp]int
+}
+
+func (c *opCounter) Trace(_ context.Context, event sqlitezstd.TraceEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ops[event.Op]++
+}
+
+func TestTracer(t *testing.T) {
+	zstPath := createDatabase(t)
+
+	tracer := &opCounter{ops: map[sqlitezstd.TraceOp]int{}}
+	sqlitezstd.SetTracer(tracer)
+	defer sqlitezstd.SetTracer(nil)
+
+	client, err := sql.Open(sqlitezstd.DriverName, fmt.Sprintf("file:%s?vfs=%s&zstd_cache=0", zstPath, sqlitezstd.VFSName()))
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	var count int64
+	require.NoError(t, client.QueryRow("SELECT COUNT(*) FROM entries;").Scan(&count))
+	require.NoError(t, client.Close())
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	assert.Positive(t, tracer.ops[sqlitezstd.TraceSourceOpen])
+	assert.Positive(t, tracer.ops[sqlitezstd.TraceSeekTableLoad])
+	assert.Positive(t, tracer.ops[sqlitezstd.TraceCacheLookup])
+	assert.Positive(t, tracer.ops[sqlitezstd.TraceDecompress])
+	assert.GreaterOrEqual(t, tracer.ops[sqlitezstd.TraceFetch], tracer.ops[sqlitezstd.TraceDecompress])
+}
+
+func TestLogger(t *testing.T) {
+	zstPath := createDatabase(t)
+
+	var buf lockedBuffer
+	sqlitezstd.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer sqlitezstd.SetLogger(nil)
+
+	client, err := sql.Open(sqlitezstd.DriverName, fmt.Sprintf("file:%s?vfs=%s", zstPath, sqlitezstd.VFSName()))
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	var count int64
+	require.NoError(t, client.QueryRow("SELECT COUNT(*) FROM entries;").Scan(&count))
+
+	assert.Contains(t, buf.String(), `msg="opened database" db=`+zstPath)
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestQueryContextStopsRemoteReads(t *testing.T) {
+	zstPath := createDatabase(t)
+	compressed, err := os.ReadFile(zstPath)
+	require.NoError(t, err)
+
+	// Serve the seek table and the first frame, but stall reads of the
+	// other frames. The seek table ends with its frame count and a
+	// descriptor whose top bit flags 4 byte checksums.
+	footer := compressed[len(compressed)-9:]
+	entrySize := 8
+	if footer[4]&0x80 != 0 {
+		entrySize = 12
+	}
+	seekTable := len(compressed) - (8 + int(binary.LittleEndian.Uint32(footer))*entrySize + len(footer))
+
+	var stalled atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test.sqlite.zst" {
+			http.NotFound(w, r)
+			return
+		}
+		var start int
+		_, _ = fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start)
+		if start > 0 && start < seekTable {
+			stalled.Add(1)
+			defer stalled.Add(-1)
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "test.sqlite.zst", time.Time{}, bytes.NewReader(compressed))
+	}))
+	defer server.Close()
+
+	client, err := sql.Open(sqlitezstd.DriverName, fmt.Sprintf("file:%s/test.sqlite.zst?vfs=%s&zstd_cache=0", server.URL, sqlitezstd.VFSName()))
+	require.NoError(t, err)
+	defer client.Close() //nolint: errcheck
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	var count int64
+	err = client.QueryRowContext(ctx, "SELECT COUNT(name) FROM entries;").Scan(&count)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Eventually(t, func() bool { return stalled.Load() == 0 }, 5*time.Second, 10*time.Millisecond)
+}